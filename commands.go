@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cyberconnecthq/indexer/fetcher"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// commonFlags are the flags shared by every command
+type commonFlags struct {
+	sources string
+	timeout time.Duration
+	format  string
+	file    string
+	rpc     string
+	// convoKey is the Convo API key, Convo is skipped without one
+	convoKey string
+	// priority ranks the sources when merging profiles, only used by identity and serve
+	priority string
+}
+
+// addPriorityFlag adds -priority to the commands that merge profiles
+func (c *commonFlags) addPriorityFlag(fs *flag.FlagSet) {
+	fs.StringVar(&c.priority, "priority", "", "comma separated sources from most to least trusted when merging profiles (default "+strings.Join(fetcher.DefaultSourcePriority, ",")+")")
+}
+
+func newFlagSet(name string, c *commonFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&c.sources, "sources", "", "comma separated sources to query, e.g. Context,Rarible (default all)")
+	fs.DurationVar(&c.timeout, "timeout", 30*time.Second, "timeout per address")
+	fs.StringVar(&c.format, "format", formatJSON, "output format: json, table or csv")
+	fs.StringVar(&c.file, "file", "", "read addresses from `path`, one or more per line")
+	fs.StringVar(&c.rpc, "rpc", os.Getenv("ETH_RPC_URL"), "Ethereum JSON-RPC `url` for ENS lookups (default $ETH_RPC_URL)")
+	fs.StringVar(&c.convoKey, "convo-key", os.Getenv("CONVO_API_KEY"), "Convo API `key`, Convo is skipped without one (default $CONVO_API_KEY)")
+	return fs
+}
+
+// parse parses args and returns the addresses to process
+func (c *commonFlags) parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	switch c.format {
+	case formatJSON, formatTable, formatCSV:
+	default:
+		return nil, fmt.Errorf("unknown format %q", c.format)
+	}
+	if _, err := c.sourceNames(); err != nil {
+		return nil, err
+	}
+	addresses, err := readAddresses(fs.Args(), c.file, os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) == 0 {
+		return nil, errors.New("no address given")
+	}
+	return addresses, nil
+}
+
+// sourceNames returns the sources selected with -sources, nil for all of them
+func (c *commonFlags) sourceNames() ([]string, error) {
+	return parseSourceList(c.sources)
+}
+
+// mergeOptions returns the profile merge options of -priority
+func (c *commonFlags) mergeOptions() (fetcher.MergeOptions, error) {
+	priority, err := parseSourceList(c.priority)
+	return fetcher.MergeOptions{SourcePriority: priority}, err
+}
+
+// parseSourceList splits a comma separated list of built-in sources, nil if it is empty
+func parseSourceList(list string) ([]string, error) {
+	if list == "" {
+		return nil, nil
+	}
+	known := make(map[string]bool)
+	for _, name := range fetcher.BuiltinSources() {
+		known[name] = true
+	}
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if !known[name] {
+			return nil, fmt.Errorf("unknown source %q, known sources are %s", name, strings.Join(fetcher.BuiltinSources(), ", "))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (c *commonFlags) newFetcher() fetcher.Fetcher {
+	var options []fetcher.Option
+	if names, _ := c.sourceNames(); names != nil {
+		options = append(options, fetcher.WithSources(names...))
+	}
+	if c.rpc != "" {
+		options = append(options, fetcher.WithEthRPC(c.rpc))
+	}
+	if c.convoKey != "" {
+		options = append(options, fetcher.WithConvoApiKey(c.convoKey))
+	}
+	return fetcher.NewFetcher(options...)
+}
+
+// checkFetchError warns about partial results and reports whether err is a failure
+func checkFetchError(input string, err error) (string, bool) {
+	if err == nil {
+		return "", false
+	}
+	var partial *fetcher.PartialResultError
+	if errors.As(err, &partial) {
+		fmt.Fprintf(os.Stderr, "warning: %s: %v\n", input, err)
+		return err.Error(), false
+	}
+	fmt.Fprintf(os.Stderr, "error: %s: %v\n", input, err)
+	return err.Error(), true
+}
+
+type identityOutput struct {
+	Input    string
+	Address  string                     `json:",omitempty"`
+	Identity *fetcher.IdentityEntryList `json:",omitempty"`
+	Profile  *fetcher.MergedProfile     `json:",omitempty"`
+	Error    string                     `json:",omitempty"`
+}
+
+func runIdentity(args []string) error {
+	var c commonFlags
+	fs := newFlagSet("identity", &c)
+	c.addPriorityFlag(fs)
+	addresses, err := c.parse(fs, args)
+	if err != nil {
+		return flagError(err)
+	}
+	mergeOptions, err := c.mergeOptions()
+	if err != nil {
+		return flagError(err)
+	}
+	f := c.newFetcher()
+
+	var outputs []identityOutput
+	failed := false
+	for _, input := range addresses {
+		output := identityOutput{Input: input}
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		address, err := f.ResolveAddress(ctx, input)
+		if err == nil {
+			output.Address = address
+			var ids fetcher.IdentityEntryList
+			ids, err = f.FetchIdentityWithContext(ctx, address)
+			profile := fetcher.NewMergedProfile(ids, mergeOptions)
+			output.Identity, output.Profile = &ids, &profile
+		}
+		cancel()
+
+		var isFailure bool
+		output.Error, isFailure = checkFetchError(input, err)
+		failed = failed || isFailure
+		outputs = append(outputs, output)
+	}
+
+	if err := writeIdentities(os.Stdout, c.format, outputs); err != nil {
+		return err
+	}
+	if failed {
+		return errors.New("some addresses failed")
+	}
+	return nil
+}
+
+type connectionsOutput struct {
+	Input       string
+	Address     string                    `json:",omitempty"`
+	Connections *fetcher.ConnectionResult `json:",omitempty"`
+	Error       string                    `json:",omitempty"`
+}
+
+func runConnections(args []string) error {
+	var c commonFlags
+	fs := newFlagSet("connections", &c)
+	addresses, err := c.parse(fs, args)
+	if err != nil {
+		return flagError(err)
+	}
+	f := c.newFetcher()
+
+	var outputs []connectionsOutput
+	failed := false
+	for _, input := range addresses {
+		output := connectionsOutput{Input: input}
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		address, err := f.ResolveAddress(ctx, input)
+		if err == nil {
+			output.Address = address
+			var conns fetcher.ConnectionResult
+			conns, err = f.FetchConnectionsWithContext(ctx, address)
+			output.Connections = &conns
+		}
+		cancel()
+
+		var isFailure bool
+		output.Error, isFailure = checkFetchError(input, err)
+		failed = failed || isFailure
+		outputs = append(outputs, output)
+	}
+
+	if err := writeConnections(os.Stdout, c.format, outputs); err != nil {
+		return err
+	}
+	if failed {
+		return errors.New("some addresses failed")
+	}
+	return nil
+}
+
+func runCrawl(args []string) error {
+	var c commonFlags
+	fs := newFlagSet("crawl", &c)
+	depth := fs.Int("depth", 1, "number of hops to walk from the given addresses")
+	limit := fs.Int("limit", 100, "maximum number of addresses to fetch connections of")
+	addresses, err := c.parse(fs, args)
+	if err != nil {
+		return flagError(err)
+	}
+	conns, failed := crawl(c.newFetcher(), addresses, *depth, *limit, c.timeout)
+	if err := writeEdges(os.Stdout, c.format, fetcher.MergeConnections(conns)); err != nil {
+		return err
+	}
+	if failed {
+		return errors.New("some addresses failed")
+	}
+	return nil
+}
+
+// crawl walks the connections of addresses breadth first for depth hops, fetching at most limit
+// addresses, and reports whether any address failed entirely. Neighbors that are ENS names left
+// unresolved are not walked, they would spend the limit on fetches keyed by a name.
+func crawl(f fetcher.Fetcher, addresses []string, depth, limit int, timeout time.Duration) ([]fetcher.ConnectionEntry, bool) {
+	type queued struct {
+		address string
+		depth   int
+	}
+	var queue []queued
+	failed := false
+	visited := make(map[string]bool)
+	for _, input := range addresses {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		address, err := f.ResolveAddress(ctx, input)
+		cancel()
+		if err != nil {
+			checkFetchError(input, err)
+			failed = true
+			continue
+		}
+		if !visited[address] {
+			visited[address] = true
+			queue = append(queue, queued{address: address})
+		}
+	}
+
+	// Breadth first, so that the limit cuts the farthest addresses
+	var conns []fetcher.ConnectionEntry
+	for fetched := 0; len(queue) != 0 && fetched < limit; fetched++ {
+		next := queue[0]
+		queue = queue[1:]
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		result, err := f.FetchConnectionsWithContext(ctx, next.address)
+		cancel()
+		if _, isFailure := checkFetchError(next.address, err); isFailure {
+			failed = true
+			continue
+		}
+		conns = append(conns, result.Conn...)
+
+		if next.depth+1 >= depth {
+			continue
+		}
+		for _, conn := range result.Conn {
+			for _, neighbor := range []string{conn.From, conn.To} {
+				if !visited[neighbor] && common.IsHexAddress(neighbor) {
+					visited[neighbor] = true
+					queue = append(queue, queued{address: neighbor, depth: next.depth + 1})
+				}
+			}
+		}
+	}
+	return conns, failed
+}
+
+// flagError turns the -h request into a clean exit
+func flagError(err error) error {
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	return err
+}
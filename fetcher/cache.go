@@ -0,0 +1,365 @@
+package fetcher
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Cache states reported in SourceStatus.Cache
+const (
+	CacheHit   = "hit"
+	CacheMiss  = "miss"
+	CacheStale = "stale"
+)
+
+// revalidateTimeout bounds the background refresh of a stale cache item
+const revalidateTimeout = time.Minute
+
+// CacheItem is a serialized source result
+type CacheItem struct {
+	Value    []byte
+	StoredAt time.Time
+	// Negative marks a result without records, e.g. "no profile"
+	Negative bool
+}
+
+// Cache stores source results keyed by source and address
+type Cache interface {
+	Get(key string) (CacheItem, bool)
+	Set(key string, item CacheItem)
+}
+
+// CachePolicy controls how long the results of a source are served from the cache
+type CachePolicy struct {
+	// TTL is how long a result is fresh
+	TTL time.Duration
+	// NegativeTTL is how long a result without records is fresh, TTL if 0
+	NegativeTTL time.Duration
+	// StaleWhileRevalidate is how long past its TTL a result is still served while it is
+	// refreshed in the background
+	StaleWhileRevalidate time.Duration
+}
+
+// DefaultCachePolicy is used for sources without a policy of their own
+var DefaultCachePolicy = CachePolicy{
+	TTL:                  10 * time.Minute,
+	NegativeTTL:          time.Minute,
+	StaleWhileRevalidate: time.Hour,
+}
+
+// WithCache serves source results from cache while they are fresh according to the source's policy
+func WithCache(cache Cache) Option {
+	return func(f *fetcher) {
+		f.cache = cache
+	}
+}
+
+// WithCachePolicy sets the cache policy of the named source, e.g. WithCachePolicy(CONTEXT, policy)
+func WithCachePolicy(source string, policy CachePolicy) Option {
+	return func(f *fetcher) {
+		if f.cachePolicies == nil {
+			f.cachePolicies = make(map[string]CachePolicy)
+		}
+		f.cachePolicies[source] = policy
+	}
+}
+
+func (f *fetcher) cachePolicy(source string) CachePolicy {
+	if policy, ok := f.cachePolicies[source]; ok {
+		return policy
+	}
+	return DefaultCachePolicy
+}
+
+func cacheKey(kind, source, address string) string {
+	return kind + "/" + source + "/" + strings.ToLower(address)
+}
+
+// cacheGet decodes the cached result of key into v, it returns CacheMiss when there is no
+// usable result
+func (f *fetcher) cacheGet(source, key string, v interface{}) (CacheItem, string) {
+	item, ok := f.cache.Get(key)
+	if !ok {
+		return item, CacheMiss
+	}
+
+	policy := f.cachePolicy(source)
+	ttl := policy.TTL
+	if item.Negative && policy.NegativeTTL > 0 {
+		ttl = policy.NegativeTTL
+	}
+	age := time.Since(item.StoredAt)
+	state := CacheHit
+	if age > ttl {
+		if age > ttl+policy.StaleWhileRevalidate {
+			return item, CacheMiss
+		}
+		state = CacheStale
+	}
+
+	if err := json.Unmarshal(item.Value, v); err != nil {
+		zap.L().With(zap.Error(err)).Error("cache item json unmarshal failed: " + key)
+		return item, CacheMiss
+	}
+	return item, state
+}
+
+// cacheStore caches v as the result of key unless the source failed
+func (f *fetcher) cacheStore(key string, v interface{}, status SourceStatus) {
+	if !status.Success {
+		return
+	}
+	value, err := json.Marshal(v)
+	if err != nil {
+		zap.L().With(zap.Error(err)).Error("cache item json marshal failed: " + key)
+		return
+	}
+	f.cache.Set(key, CacheItem{
+		Value:    value,
+		StoredAt: status.FetchedAt,
+		Negative: status.Count == 0,
+	})
+}
+
+// revalidate runs refresh in the background unless a refresh of key is already running
+func (f *fetcher) revalidate(key string, refresh func(ctx context.Context)) {
+	if _, running := f.revalidating.LoadOrStore(key, true); running {
+		return
+	}
+	go func() {
+		defer f.revalidating.Delete(key)
+		ctx, cancel := context.WithTimeout(context.Background(), revalidateTimeout)
+		defer cancel()
+		refresh(ctx)
+	}()
+}
+
+// MemoryCache is an in-memory Cache evicting the least recently used items
+type MemoryCache struct {
+	capacity int
+
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+type memoryCacheEntry struct {
+	key  string
+	item CacheItem
+}
+
+// NewMemoryCache returns a MemoryCache holding up to capacity items
+func NewMemoryCache(capacity int) *MemoryCache {
+	return &MemoryCache{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *MemoryCache) Get(key string) (CacheItem, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return CacheItem{}, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*memoryCacheEntry).item, true
+}
+
+func (c *MemoryCache) Set(key string, item CacheItem) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*memoryCacheEntry).item = item
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.order.PushFront(&memoryCacheEntry{key: key, item: item})
+	for c.capacity > 0 && c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*memoryCacheEntry).key)
+	}
+}
+
+const (
+	// DiskCacheDefaultMaxAge is how long a DiskCache keeps an item unless set with DiskCacheMaxAge
+	DiskCacheDefaultMaxAge = 7 * 24 * time.Hour
+	// DiskCacheDefaultMaxItems is the number of items a DiskCache keeps unless set with DiskCacheMaxItems
+	DiskCacheDefaultMaxItems = 100000
+	// diskCachePruneInterval is how often writes trigger a cleanup of the directory
+	diskCachePruneInterval = 10 * time.Minute
+)
+
+// DiskCache is a Cache keeping one JSON file per item in a directory. Items older than its max
+// age are removed, and the oldest items once there are more than its max items.
+type DiskCache struct {
+	dir      string
+	maxAge   time.Duration
+	maxItems int
+
+	mu        sync.Mutex
+	lastPrune time.Time
+	sets      int
+	pruning   bool
+}
+
+type DiskCacheOption func(*DiskCache)
+
+// DiskCacheMaxAge sets how long items are kept, whatever the cache policy of their source
+func DiskCacheMaxAge(maxAge time.Duration) DiskCacheOption {
+	return func(c *DiskCache) {
+		c.maxAge = maxAge
+	}
+}
+
+// DiskCacheMaxItems sets the number of items kept
+func DiskCacheMaxItems(maxItems int) DiskCacheOption {
+	return func(c *DiskCache) {
+		c.maxItems = maxItems
+	}
+}
+
+// NewDiskCache returns a DiskCache in dir, creating it if needed, and cleans it up
+func NewDiskCache(dir string, options ...DiskCacheOption) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &DiskCache{
+		dir:      dir,
+		maxAge:   DiskCacheDefaultMaxAge,
+		maxItems: DiskCacheDefaultMaxItems,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	if err := c.Prune(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Prune removes the items older than the max age, then the oldest items over the max items.
+// Writes call it in the background every now and then.
+func (c *DiskCache) Prune() error {
+	c.mu.Lock()
+	c.lastPrune, c.sets = time.Now(), 0
+	c.mu.Unlock()
+
+	infos, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	var items []os.FileInfo
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		// Leftovers of interrupted writes
+		if strings.HasPrefix(info.Name(), "tmp-") {
+			if time.Since(info.ModTime()) > time.Hour {
+				os.Remove(filepath.Join(c.dir, info.Name()))
+			}
+			continue
+		}
+		if !strings.HasSuffix(info.Name(), ".json") {
+			continue
+		}
+		if c.maxAge > 0 && time.Since(info.ModTime()) > c.maxAge {
+			os.Remove(filepath.Join(c.dir, info.Name()))
+			continue
+		}
+		items = append(items, info)
+	}
+
+	if c.maxItems > 0 && len(items) > c.maxItems {
+		sort.Slice(items, func(i, j int) bool {
+			return items[i].ModTime().After(items[j].ModTime())
+		})
+		for _, info := range items[c.maxItems:] {
+			os.Remove(filepath.Join(c.dir, info.Name()))
+		}
+	}
+	return nil
+}
+
+// maybePrune starts a background Prune when the last one is old or many items were written since
+func (c *DiskCache) maybePrune() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sets++
+	due := time.Since(c.lastPrune) > diskCachePruneInterval || (c.maxItems > 0 && c.sets > c.maxItems/10)
+	if !due || c.pruning {
+		return
+	}
+	c.pruning = true
+	go func() {
+		if err := c.Prune(); err != nil {
+			zap.L().With(zap.Error(err)).Error("disk cache prune failed")
+		}
+		c.mu.Lock()
+		c.pruning = false
+		c.mu.Unlock()
+	}()
+}
+
+func (c *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *DiskCache) Get(key string) (CacheItem, bool) {
+	body, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return CacheItem{}, false
+	}
+	var item CacheItem
+	if err := json.Unmarshal(body, &item); err != nil {
+		return CacheItem{}, false
+	}
+	if c.maxAge > 0 && time.Since(item.StoredAt) > c.maxAge {
+		os.Remove(c.path(key))
+		return CacheItem{}, false
+	}
+	return item, true
+}
+
+func (c *DiskCache) Set(key string, item CacheItem) {
+	body, err := json.Marshal(item)
+	if err != nil {
+		return
+	}
+	// Write aside and rename so that readers never see a partial file
+	tmp, err := ioutil.TempFile(c.dir, "tmp-")
+	if err != nil {
+		zap.L().With(zap.Error(err)).Error("disk cache write failed")
+		return
+	}
+	_, err = tmp.Write(body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		zap.L().With(zap.Error(err)).Error("disk cache write failed")
+		return
+	}
+	c.maybePrune()
+}
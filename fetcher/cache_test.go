@@ -0,0 +1,256 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheEviction(t *testing.T) {
+	c := NewMemoryCache(2)
+	c.Set("a", CacheItem{Value: []byte("a")})
+	c.Set("b", CacheItem{Value: []byte("b")})
+	c.Get("a")
+	c.Set("c", CacheItem{Value: []byte("c")})
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("least recently used item was kept")
+	}
+	for _, key := range []string{"a", "c"} {
+		if item, ok := c.Get(key); !ok || string(item.Value) != key {
+			t.Errorf("%s: got %+v, %v", key, item, ok)
+		}
+	}
+}
+
+func newTestDiskCache(t *testing.T, options ...DiskCacheOption) (*DiskCache, string) {
+	dir, err := ioutil.TempDir("", "diskcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	c, err := NewDiskCache(dir, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, dir
+}
+
+func cacheFiles(t *testing.T, dir string) int {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(infos)
+}
+
+func TestDiskCache(t *testing.T) {
+	c, _ := newTestDiskCache(t)
+	stored := time.Now().Truncate(time.Second)
+	c.Set("identity/Zora/0xabc", CacheItem{Value: []byte(`{}`), StoredAt: stored, Negative: true})
+
+	item, ok := c.Get("identity/Zora/0xabc")
+	if !ok || string(item.Value) != `{}` || !item.StoredAt.Equal(stored) || !item.Negative {
+		t.Errorf("got %+v, %v", item, ok)
+	}
+	if _, ok := c.Get("identity/Zora/0xdef"); ok {
+		t.Error("unexpected item")
+	}
+}
+
+func TestDiskCacheMaxItems(t *testing.T) {
+	c, dir := newTestDiskCache(t, DiskCacheMaxItems(3))
+	// Keep Set from pruning in the background while the test does
+	c.mu.Lock()
+	c.pruning = true
+	c.mu.Unlock()
+
+	keys := []string{"a", "b", "c", "d", "e"}
+	for i, key := range keys {
+		c.Set(key, CacheItem{StoredAt: time.Now()})
+		modTime := time.Now().Add(time.Duration(i-len(keys)) * time.Minute)
+		if err := os.Chtimes(c.path(key), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Prune(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := cacheFiles(t, dir); n != 3 {
+		t.Errorf("%d files left", n)
+	}
+	for i, key := range keys {
+		if _, ok := c.Get(key); ok != (i >= 2) {
+			t.Errorf("%s kept: %v", key, ok)
+		}
+	}
+}
+
+func TestDiskCacheMaxAge(t *testing.T) {
+	c, dir := newTestDiskCache(t, DiskCacheMaxAge(time.Hour))
+	c.Set("old", CacheItem{StoredAt: time.Now().Add(-2 * time.Hour)})
+	c.Set("new", CacheItem{StoredAt: time.Now()})
+	if _, ok := c.Get("old"); ok {
+		t.Error("item past the max age was served")
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	c.Set("old", CacheItem{StoredAt: time.Now()})
+	os.Chtimes(c.path("old"), old, old)
+	leftover := filepath.Join(dir, "tmp-123")
+	ioutil.WriteFile(leftover, nil, 0644)
+	os.Chtimes(leftover, old, old)
+	if err := c.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if n := cacheFiles(t, dir); n != 1 {
+		t.Errorf("%d files left", n)
+	}
+	if _, ok := c.Get("new"); !ok {
+		t.Error("fresh item was removed")
+	}
+}
+
+// countingSource is an identity source counting its fetches, it finds a Zora profile unless
+// empty, and fails when failing
+type countingSource struct {
+	fetches int32
+	empty   bool
+	failing bool
+}
+
+func (s *countingSource) Name() string {
+	return "Counting"
+}
+
+func (s *countingSource) FetchIdentity(ctx context.Context, address string) IdentityEntry {
+	atomic.AddInt32(&s.fetches, 1)
+	switch {
+	case s.failing:
+		return IdentityEntry{Err: errors.New("boom")}
+	case s.empty:
+		return IdentityEntry{}
+	}
+	return IdentityEntry{Zora: &UserZoraIdentity{Username: "fetched", DataSource: "Counting"}}
+}
+
+func newCachingFetcher(source *countingSource, policy CachePolicy) (*fetcher, *MemoryCache) {
+	cache := NewMemoryCache(10)
+	f := NewFetcher(
+		WithIdentitySources(source),
+		WithSources(source.Name()),
+		WithCache(cache),
+		WithCachePolicy(source.Name(), policy),
+	)
+	return f, cache
+}
+
+// storeCached puts a result of the counting source stored age ago into cache
+func storeCached(t *testing.T, cache Cache, entry IdentityEntry, age time.Duration) {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Set(cacheKey("identity", "Counting", testAddress), CacheItem{
+		Value:    value,
+		StoredAt: time.Now().Add(-age),
+		Negative: entry.count() == 0,
+	})
+}
+
+func cachedEntry() IdentityEntry {
+	return IdentityEntry{Zora: &UserZoraIdentity{Username: "cached", DataSource: "Counting"}}
+}
+
+func TestCacheHit(t *testing.T) {
+	source := &countingSource{}
+	f, _ := newCachingFetcher(source, CachePolicy{TTL: time.Minute})
+
+	for i, want := range []string{CacheMiss, CacheHit} {
+		ids, err := f.FetchIdentity(testAddress)
+		if err != nil || len(ids.Zora) != 1 || ids.Sources[0].Cache != want {
+			t.Errorf("fetch %d: got %+v, %v, want %s", i, ids.Sources, err, want)
+		}
+	}
+	if source.fetches != 1 {
+		t.Errorf("fetched %d times", source.fetches)
+	}
+}
+
+func TestCacheExpired(t *testing.T) {
+	source := &countingSource{}
+	f, cache := newCachingFetcher(source, CachePolicy{TTL: time.Minute, StaleWhileRevalidate: time.Minute})
+	storeCached(t, cache, cachedEntry(), 3*time.Minute)
+
+	ids, _ := f.FetchIdentity(testAddress)
+	if ids.Zora[0].Username != "fetched" || ids.Sources[0].Cache != CacheMiss || source.fetches != 1 {
+		t.Errorf("got %+v, %+v after %d fetches", ids.Zora, ids.Sources, source.fetches)
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	source := &countingSource{}
+	f, cache := newCachingFetcher(source, CachePolicy{TTL: time.Minute, StaleWhileRevalidate: time.Hour})
+	storeCached(t, cache, cachedEntry(), 5*time.Minute)
+
+	ids, _ := f.FetchIdentity(testAddress)
+	if ids.Zora[0].Username != "cached" || ids.Sources[0].Cache != CacheStale {
+		t.Errorf("got %+v, %+v", ids.Zora, ids.Sources)
+	}
+
+	// The refresh runs in the background and replaces the stale item
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ids, _ = f.FetchIdentity(testAddress)
+		if ids.Sources[0].Cache == CacheHit {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stale item was not refreshed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ids.Zora[0].Username != "fetched" || atomic.LoadInt32(&source.fetches) != 1 {
+		t.Errorf("got %+v after %d fetches", ids.Zora, source.fetches)
+	}
+}
+
+func TestCacheNegativeTTL(t *testing.T) {
+	policy := CachePolicy{TTL: time.Hour, NegativeTTL: time.Minute}
+
+	source := &countingSource{empty: true}
+	f, cache := newCachingFetcher(source, policy)
+	storeCached(t, cache, IdentityEntry{}, 5*time.Minute)
+	ids, _ := f.FetchIdentity(testAddress)
+	if ids.Sources[0].Cache != CacheMiss || source.fetches != 1 {
+		t.Errorf("expired negative result: got %+v after %d fetches", ids.Sources, source.fetches)
+	}
+
+	source = &countingSource{}
+	f, cache = newCachingFetcher(source, policy)
+	storeCached(t, cache, cachedEntry(), 5*time.Minute)
+	ids, _ = f.FetchIdentity(testAddress)
+	if ids.Sources[0].Cache != CacheHit || source.fetches != 0 {
+		t.Errorf("fresh result: got %+v after %d fetches", ids.Sources, source.fetches)
+	}
+}
+
+func TestCacheSkipsFailures(t *testing.T) {
+	source := &countingSource{failing: true}
+	f, _ := newCachingFetcher(source, CachePolicy{TTL: time.Hour})
+	for i := 0; i < 2; i++ {
+		if _, err := f.FetchIdentity(testAddress); err == nil {
+			t.Fatal("expected an error")
+		}
+	}
+	if source.fetches != 2 {
+		t.Errorf("fetched %d times", source.fetches)
+	}
+}
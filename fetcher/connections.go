@@ -1,89 +1,226 @@
 package fetcher
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 )
 
-const ConnectionApiCount = 2
+func (f *fetcher) FetchConnections(address string) (ConnectionResult, error) {
+	return f.FetchConnectionsWithContext(context.Background(), address)
+}
 
-func (f *fetcher) FetchConnections(address string) (results []ConnectionEntry, err error) {
-	ch := make(chan ConnectionEntryList)
+func (f *fetcher) FetchConnectionsWithContext(ctx context.Context, address string) (ConnectionResult, error) {
+	var results ConnectionResult
+	type sourceResult struct {
+		index int
+		res   connectionResult
+	}
+	// Buffered so that source goroutines never block once we stop receiving
+	ch := make(chan sourceResult, len(f.connectionSources))
 
-	// Part 1 - Demo data source
-	// Context API
-	go f.processContextConn(address, ch)
-	// Rarible API
-	go f.processRaribleConn(address, ch)
-	// Part 2 - Add other data source here
-	// TODO
+	// Part 1 - Query every registered data source
+	for i, source := range f.connectionSources {
+		go func(i int, source ConnectionSource) {
+			ch <- sourceResult{i, f.runConnectionSource(ctx, source, address)}
+		}(i, source)
+	}
 
-	// Final Part - Aggregate all data & convert ens domain & filter out invalid connections
-	for i := 0; i < ConnectionApiCount; i++ {
-		entry := <-ch
+	// Final Part - Aggregate all data & convert ens domain & filter out invalid connections.
+	// Results are merged in the order the sources are registered, whatever the order they
+	// answer in, so that offsets into Conn are stable across calls. When ctx is done the
+	// results received so far are returned, like FetchIdentityWithContext does.
+	ordered := make([]*connectionResult, len(f.connectionSources))
+	var ctxErr error
+	for i := 0; i < len(f.connectionSources) && ctxErr == nil; i++ {
+		select {
+		case sr := <-ch:
+			ordered[sr.index] = &sr.res
+		case <-ctx.Done():
+			ctxErr = ctx.Err()
+		}
+	}
+	for _, res := range ordered {
+		if res == nil {
+			continue
+		}
+		results.Sources = append(results.Sources, res.status)
+
+		entry := res.entry
 		if entry.Err != nil {
 			zap.L().With(zap.Error(entry.Err)).Error("connection api error: " + entry.msg)
 			continue
 		}
-		results = append(results, entry.Conn...)
+		results.Conn = append(results.Conn, entry.Conn...)
+	}
+	results.Conn = f.normalizeConnections(ctx, results.Conn)
+	results.Platforms, results.Summary = splitConnections(address, results.Conn)
+
+	if ctxErr != nil {
+		return results, ctxErr
+	}
+	return results, partialResultError(results.Sources)
+}
+
+// normalizeConnections turns every endpoint into a lowercase 0x address, ENS names are resolved
+// in one batch and kept in FromEns / ToEns. Without an ENS backend names are left as they are,
+// with one, connections to names that do not resolve are dropped and names whose lookup failed
+// are left as they are.
+func (f *fetcher) normalizeConnections(ctx context.Context, conns []ConnectionEntry) []ConnectionEntry {
+	var names []string
+	seen := make(map[string]bool)
+	for _, conn := range conns {
+		for _, endpoint := range []string{conn.From, conn.To} {
+			name := strings.ToLower(endpoint)
+			if isAddress(endpoint) || seen[name] {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	var resolved map[string]string
+	if f.ensBackend != nil && len(names) != 0 {
+		resolved = f.resolveEnsNames(ctx, names)
+	} else if len(names) != 0 {
+		zap.L().Warn("no ENS backend configured, connections keep ENS names instead of addresses", zap.Int("names", len(names)))
+	}
+
+	var results []ConnectionEntry
+	for _, conn := range conns {
+		from, fromEns, fromOk := f.normalizeEndpoint(conn.From, resolved)
+		to, toEns, toOk := f.normalizeEndpoint(conn.To, resolved)
+		if !fromOk || !toOk {
+			continue
+		}
+		conn.From, conn.FromEns = from, fromEns
+		conn.To, conn.ToEns = to, toEns
+		results = append(results, conn)
 	}
+	return results
+}
 
-	return
+// normalizeEndpoint returns the address and ENS name of endpoint, ok is false when endpoint is an
+// ENS name that does not resolve. A name that could not be looked up is returned lowercase as the
+// address, so that every spelling of it is one endpoint.
+func (f *fetcher) normalizeEndpoint(endpoint string, resolved map[string]string) (address string, name string, ok bool) {
+	if isAddress(endpoint) {
+		address = strings.ToLower(endpoint)
+		if !strings.HasPrefix(address, "0x") {
+			address = "0x" + address
+		}
+		return address, "", true
+	}
+	name = strings.ToLower(endpoint)
+	if f.ensBackend == nil {
+		return name, "", true
+	}
+	address, found := resolved[name]
+	if !found {
+		return name, "", true
+	}
+	return address, name, address != ""
 }
 
-func (f *fetcher) getRaribleConnection(address string, isFollowing bool) ([]RaribleConnectionResp, error) {
+func (f *fetcher) getRaribleConnection(ctx context.Context, address string, isFollowing bool) ([]RaribleConnectionResp, error) {
 	// Prepare request
 	var url string
 	if isFollowing {
-		url = fmt.Sprintf(RaribleFollowingUrl, address)
+		url = f.sourceURL(RARIBLE, RaribleFollowingUrl, address)
 	} else {
-		url = fmt.Sprintf(RaribleFollowerUrl, address)
+		url = f.sourceURL(RARIBLE, RaribleFollowerUrl, address)
+	}
+	pageSize := f.raribleOptions.PageSize
+	if pageSize <= 0 {
+		pageSize = RaribleDefaultPageSize
+	}
+	maxTotal := f.raribleOptions.MaxTotal
+	maxPages := f.raribleOptions.MaxPages
+	if maxPages <= 0 {
+		maxPages = RaribleDefaultMaxPages
 	}
 
-	postBody, _ := json.Marshal(map[string]int{
-		"size": 5000, // TODO
-	})
+	var results []RaribleConnectionResp
+	continuation := ""
+	for pages := 1; ; pages++ {
+		size := pageSize
+		if maxTotal > 0 && maxTotal-len(results) < size {
+			size = maxTotal - len(results)
+		}
+		reqBody := map[string]interface{}{
+			"size": size,
+		}
+		if continuation != "" {
+			reqBody["continuation"] = continuation
+		}
+		postBody, _ := json.Marshal(reqBody)
 
-	body, err := sendRequest(f.httpClient, RequestArgs{
-		url:    url,
-		method: "POST",
-		body:   postBody,
-	})
+		body, err := sendRequest(ctx, f.httpClient, RequestArgs{
+			url:    url,
+			method: "POST",
+			body:   postBody,
+		})
+		if err != nil {
+			return nil, err
+		}
 
-	var results []RaribleConnectionResp
-	err = json.Unmarshal(body, &results)
-	if err != nil {
-		return nil, err
+		var page []RaribleConnectionResp
+		err = json.Unmarshal(body, &page)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, page...)
+		if f.raribleOptions.OnPage != nil && len(page) != 0 {
+			f.raribleOptions.OnPage(raribleConnectionEntries(page))
+		}
+
+		// A short page is the last one
+		if len(page) < size || page[len(page)-1].Id == "" || (maxTotal > 0 && len(results) >= maxTotal) {
+			break
+		}
+		// Rarible ignoring the continuation would serve the same page forever
+		if page[len(page)-1].Id == continuation || pages >= maxPages {
+			zap.L().Warn(fmt.Sprintf("rarible paging stopped after %d pages: %s", pages, address))
+			break
+		}
+		continuation = page[len(page)-1].Id
 	}
 	return results, nil
 }
 
-func (f *fetcher) processRaribleConn(address string, ch chan<- ConnectionEntryList) {
+func (f *fetcher) processRaribleConn(ctx context.Context, address string) ConnectionEntryList {
 	var rarTotal []RaribleConnectionResp
 	result := ConnectionEntryList{}
 
 	// Query Followings from Rarible
-	rarFollowings, err := f.getRaribleConnection(address, true)
+	rarFollowings, err := f.getRaribleConnection(ctx, address, true)
 	if err != nil {
 		result.Err = err
 		result.msg = "[processRaribleConn] fetch Rarible followings failed"
-		ch <- result
-		return
+		return result
 	}
 
 	// Query Followers from Rarible
-	rarFollowers, err := f.getRaribleConnection(address, false)
+	rarFollowers, err := f.getRaribleConnection(ctx, address, false)
 	if err != nil {
 		result.Err = err
 		result.msg = "[processRaribleConn] fetch Rarible followers failed"
-		ch <- result
-		return
+		return result
 	}
 
-	// Merge and printing out for Rarible followings
+	// Merge Rarible followers and followings
 	rarTotal = append(rarFollowers, rarFollowings...)
+	result.Conn = append(result.Conn, raribleConnectionEntries(rarTotal)...)
+	return result
+}
+
+// raribleConnectionEntries converts Rarible followings into connection entries, skipping invalid ones
+func raribleConnectionEntries(rarTotal []RaribleConnectionResp) []ConnectionEntry {
 	var results []ConnectionEntry
 	for i := 0; i < len(rarTotal); i++ {
 		if !addressFilter(rarTotal[i].Following.From) || !addressFilter(rarTotal[i].Following.To) {
@@ -96,21 +233,19 @@ func (f *fetcher) processRaribleConn(address string, ch chan<- ConnectionEntryLi
 		}
 		results = append(results, result)
 	}
-
-	result.Conn = append(result.Conn, results...)
-	ch <- result
+	return results
 }
 
-func (f *fetcher) getUserContextConnection(address string, isFollowing bool) (results []ConnectionEntry, err error) {
+func (f *fetcher) getUserContextConnection(ctx context.Context, address string, isFollowing bool) (results []ConnectionEntry, err error) {
 	var url string
 
 	if isFollowing {
-		url = fmt.Sprintf(ContextUrl, address+"/following")
+		url = f.sourceURL(CONTEXT, ContextUrl, address+"/following")
 	} else {
-		url = fmt.Sprintf(ContextUrl, address+"/followers")
+		url = f.sourceURL(CONTEXT, ContextUrl, address+"/followers")
 	}
 
-	body, err := sendRequest(f.httpClient, RequestArgs{
+	body, err := sendRequest(ctx, f.httpClient, RequestArgs{
 		url:    url,
 		method: "GET",
 	})
@@ -170,27 +305,79 @@ func (f *fetcher) getUserContextConnection(address string, isFollowing bool) (re
 	return results, nil
 }
 
-func (f *fetcher) processContextConn(address string, ch chan<- ConnectionEntryList) {
+func (f *fetcher) processContextConn(ctx context.Context, address string) ConnectionEntryList {
 	result := ConnectionEntryList{}
-	followingResults, err := f.getUserContextConnection(address, true)
+	followingResults, err := f.getUserContextConnection(ctx, address, true)
 	if err != nil {
 		result.Err = err
 		result.msg = "[processContextConn] fetch Context followings failed"
-		ch <- result
-		return
+		return result
 	}
 
-	followerResults, err := f.getUserContextConnection(address, false)
+	followerResults, err := f.getUserContextConnection(ctx, address, false)
 	if err != nil {
 		result.Err = err
 		result.msg = "[processContextConn] fetch Context followers failed"
-		ch <- result
-		return
+		return result
 	}
 
 	followingResults = append(followingResults, followerResults...)
 	result.Conn = append(result.Conn, followingResults...)
-	ch <- result
+	return result
+}
+
+func (f *fetcher) processConvoConn(ctx context.Context, address string) ConnectionEntryList {
+	result := ConnectionEntryList{}
+
+	body, err := sendRequest(ctx, f.httpClient, RequestArgs{
+		url:    f.sourceURL(CONVO, ConvoThreadsUrl, address, f.convoApiKey),
+		method: "GET",
+	})
+	if err != nil {
+		result.Err = err
+		result.msg = "[processConvoConn] fetch Convo threads failed"
+		return result
+	}
+
+	var threads []ConvoThread
+	err = json.Unmarshal(body, &threads)
+	if err != nil {
+		result.Err = err
+		result.msg = "[processConvoConn] threads response json unmarshal failed"
+		return result
+	}
+
+	// Joining a thread follows its creator, members of the address's own threads follow the address
+	for _, thread := range threads {
+		if !addressFilter(thread.Creator) {
+			continue
+		}
+		var createdAt time.Time
+		if thread.CreatedOn != 0 {
+			createdAt = time.Unix(0, thread.CreatedOn*int64(time.Millisecond))
+		}
+		if !strings.EqualFold(thread.Creator, address) {
+			result.Conn = append(result.Conn, ConnectionEntry{
+				From:      address,
+				To:        thread.Creator,
+				Platform:  CONVO,
+				CreatedAt: createdAt,
+			})
+			continue
+		}
+		for _, member := range thread.Members {
+			if strings.EqualFold(member, address) || !addressFilter(member) {
+				continue
+			}
+			result.Conn = append(result.Conn, ConnectionEntry{
+				From:      member,
+				To:        address,
+				Platform:  CONVO,
+				CreatedAt: createdAt,
+			})
+		}
+	}
+	return result
 }
 
 // return false if input is neither Ethereum address nor ENS
@@ -0,0 +1,389 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testFollowing = "0x1111111111111111111111111111111111111111"
+	testFollower  = "0x2222222222222222222222222222222222222222"
+)
+
+func TestGetUserContextConnection(t *testing.T) {
+	f := newTestFetcher(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/profile/" + testAddress + "/following":
+			w.Write([]byte(`{
+				"relationships": [{"actor": "` + testFollowing + `"}, {"actor": "alice"}, {"actor": "unknown"}],
+				"profiles": {"alice": [{"address": "alice.eth"}]}
+			}`))
+		case "/api/profile/" + testAddress + "/followers":
+			w.Write([]byte(`{
+				"relationships": [{"actor": "bob"}, {"actor": "spam"}, {"actor": "unknown"}],
+				"profiles": {"bob": [{"address": "` + testFollower + `"}], "spam": [{"address": "not-an-address"}]}
+			}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	followings, err := f.getUserContextConnection(noRetryContext(), testAddress, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []ConnectionEntry{
+		{From: testAddress, To: testFollowing, Platform: CONTEXT},
+		{From: testAddress, To: "alice.eth", Platform: CONTEXT},
+	}
+	if !reflect.DeepEqual(followings, want) {
+		t.Errorf("followings = %+v, want %+v", followings, want)
+	}
+
+	followers, err := f.getUserContextConnection(noRetryContext(), testAddress, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = []ConnectionEntry{
+		{From: testFollower, To: testAddress, Platform: CONTEXT},
+	}
+	if !reflect.DeepEqual(followers, want) {
+		t.Errorf("followers = %+v, want %+v", followers, want)
+	}
+}
+
+func TestGetUserContextConnectionErrors(t *testing.T) {
+	for name, handler := range map[string]http.Handler{
+		"http error":     respond(http.StatusNotFound, ""),
+		"malformed json": respond(http.StatusOK, `{"relationships": {}}`),
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := newTestFetcher(t, handler)
+			if _, err := f.getUserContextConnection(noRetryContext(), testAddress, true); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+// raribleHandler serves total followers of testAddress in pages, recording the request bodies
+func raribleHandler(total int, requests *[]map[string]interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var req map[string]interface{}
+		json.Unmarshal(body, &req)
+		*requests = append(*requests, req)
+
+		start := 0
+		if continuation, ok := req["continuation"].(string); ok {
+			fmt.Sscanf(continuation, "%d", &start)
+		}
+		size := int(req["size"].(float64))
+		var page []map[string]interface{}
+		for i := start; i < total && i < start+size; i++ {
+			page = append(page, map[string]interface{}{
+				"id": fmt.Sprint(i + 1),
+				"following": map[string]string{
+					"owner": fmt.Sprintf("0x%040d", i),
+					"user":  testAddress,
+				},
+			})
+		}
+		json.NewEncoder(w).Encode(page)
+	})
+}
+
+func TestGetRaribleConnectionPagination(t *testing.T) {
+	var requests []map[string]interface{}
+	var pages [][]ConnectionEntry
+	f := newTestFetcher(t, raribleHandler(5, &requests), WithRaribleOptions(RaribleOptions{
+		PageSize: 2,
+		OnPage: func(page []ConnectionEntry) {
+			pages = append(pages, page)
+		},
+	}))
+
+	results, err := f.getRaribleConnection(noRetryContext(), testAddress, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 5 {
+		t.Errorf("got %d followers, want 5", len(results))
+	}
+	if len(requests) != 3 {
+		t.Fatalf("sent %d requests, want 3", len(requests))
+	}
+	if _, ok := requests[0]["continuation"]; ok {
+		t.Errorf("first request has a continuation: %v", requests[0])
+	}
+	if requests[2]["continuation"] != "4" {
+		t.Errorf("last continuation = %v, want 4", requests[2]["continuation"])
+	}
+	if len(pages) != 3 || len(pages[2]) != 1 || pages[2][0].Platform != RARIBLE {
+		t.Errorf("pages = %+v", pages)
+	}
+}
+
+func TestGetRaribleConnectionMaxTotal(t *testing.T) {
+	var requests []map[string]interface{}
+	f := newTestFetcher(t, raribleHandler(10, &requests), WithRaribleOptions(RaribleOptions{
+		PageSize: 4,
+		MaxTotal: 6,
+	}))
+
+	results, err := f.getRaribleConnection(noRetryContext(), testAddress, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 6 {
+		t.Errorf("got %d followings, want 6", len(results))
+	}
+	if len(requests) != 2 || requests[1]["size"] != float64(2) {
+		t.Errorf("requests = %v", requests)
+	}
+}
+
+func TestGetRaribleConnectionIgnoredContinuation(t *testing.T) {
+	var requests []map[string]interface{}
+	rarible := raribleHandler(100, &requests)
+	// Serve the first page whatever the continuation
+	f := newTestFetcher(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = ioutil.NopCloser(strings.NewReader(`{"size": 2}`))
+		rarible.ServeHTTP(w, r)
+	}), WithRaribleOptions(RaribleOptions{PageSize: 2}))
+
+	results, err := f.getRaribleConnection(noRetryContext(), testAddress, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(requests) != 2 || len(results) != 4 {
+		t.Errorf("got %d results in %d requests", len(results), len(requests))
+	}
+}
+
+func TestGetRaribleConnectionMaxPages(t *testing.T) {
+	var requests []map[string]interface{}
+	f := newTestFetcher(t, raribleHandler(1<<20, &requests), WithRaribleOptions(RaribleOptions{
+		PageSize: 2,
+		MaxPages: 3,
+	}))
+
+	results, err := f.getRaribleConnection(noRetryContext(), testAddress, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(requests) != 3 || len(results) != 6 {
+		t.Errorf("got %d results in %d requests", len(results), len(requests))
+	}
+}
+
+func TestGetRaribleConnectionErrors(t *testing.T) {
+	for name, handler := range map[string]http.Handler{
+		"http error":     respond(http.StatusBadRequest, ""),
+		"malformed json": respond(http.StatusOK, `[{"following": "0x"}]`),
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := newTestFetcher(t, handler)
+			results, err := f.getRaribleConnection(noRetryContext(), testAddress, true)
+			if err == nil {
+				t.Fatalf("expected an error, got %+v", results)
+			}
+		})
+	}
+}
+
+func TestProcessConvoConn(t *testing.T) {
+	var query url.Values
+	f := newTestFetcher(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte(`[
+			{"_id": "1", "creator": "` + testFollowing + `", "members": ["` + testAddress + `"], "createdOn": 1600000000000},
+			{"_id": "2", "creator": "` + testAddress + `", "members": ["` + testAddress + `", "` + testFollower + `", "not-an-address"]},
+			{"_id": "3", "creator": "not-an-address", "members": ["` + testAddress + `"]}
+		]`))
+	}), WithConvoApiKey("key"))
+
+	list := f.processConvoConn(noRetryContext(), testAddress)
+	if list.Err != nil {
+		t.Fatalf("unexpected error: %v", list.Err)
+	}
+	if query.Get("member") != testAddress || query.Get("apikey") != "key" {
+		t.Errorf("query = %v", query)
+	}
+	want := []ConnectionEntry{
+		{From: testAddress, To: testFollowing, Platform: CONVO, CreatedAt: time.Unix(1600000000, 0)},
+		{From: testFollower, To: testAddress, Platform: CONVO},
+	}
+	if !reflect.DeepEqual(list.Conn, want) {
+		t.Errorf("connections = %+v, want %+v", list.Conn, want)
+	}
+}
+
+func TestProcessConvoConnErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.Handler
+		msg     string
+	}{
+		{"http error", respond(http.StatusUnauthorized, ""), "[processConvoConn] fetch Convo threads failed"},
+		{"malformed json", respond(http.StatusOK, `{"threads": []}`), "[processConvoConn] threads response json unmarshal failed"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newTestFetcher(t, test.handler)
+			list := f.processConvoConn(noRetryContext(), testAddress)
+			if list.Err == nil {
+				t.Fatalf("expected an error, got %+v", list.Conn)
+			}
+			if list.msg != test.msg {
+				t.Errorf("msg = %q, want %q", list.msg, test.msg)
+			}
+		})
+	}
+}
+
+func TestFilterConnections(t *testing.T) {
+	conns := []ConnectionEntry{
+		{From: testAddress, To: testFollowing, Platform: RARIBLE},
+		{From: testFollower, To: testAddress, Platform: CONTEXT},
+		{From: testFollowing, To: "0x" + strings.ToUpper(testAddress[2:]), Platform: CONVO},
+		// Neither end or both ends the queried address, dropped
+		{From: testAddress, To: testAddress, Platform: RARIBLE},
+		{From: testFollowing, To: testFollower, Platform: RARIBLE},
+	}
+	tests := map[string][]ConnectionEntry{
+		DirectionAll:       {conns[0], conns[1], conns[2]},
+		DirectionFollowing: {conns[0]},
+		DirectionFollower:  {conns[1], conns[2]},
+		// Followed on Rarible and following back on Convo
+		DirectionMutual: {conns[0], conns[2]},
+	}
+	for direction, want := range tests {
+		if got := FilterConnections(testAddress, conns, direction); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", direction, got, want)
+		}
+	}
+}
+
+func TestConvoApiKeyNotLeaked(t *testing.T) {
+	const key = "SECRETKEY"
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	failing := httptest.NewServer(respond(http.StatusInternalServerError, ""))
+	defer failing.Close()
+
+	for name, options := range map[string][]Option{
+		"transport error": {WithBaseURL(CONVO, closed.URL)},
+		"http error":      {WithBaseURL(CONVO, failing.URL)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			options = append(options, WithConvoApiKey(key), WithSources(CONVO), WithRetryPolicy(CONVO, RetryPolicy{}))
+			results, err := NewFetcher(options...).FetchConnections(testAddress)
+			if err == nil || len(results.Sources) != 1 || results.Sources[0].Err == nil {
+				t.Fatalf("got %+v, %v", results.Sources, err)
+			}
+			status, _ := json.Marshal(results.Sources)
+			var httpErr *HTTPError
+			if errors.As(results.Sources[0].Err, &httpErr) && strings.Contains(httpErr.URL, key) {
+				t.Errorf("key in HTTPError.URL %q", httpErr.URL)
+			}
+			for _, s := range []string{err.Error(), fmt.Sprintf("%+v", results.Sources), string(status)} {
+				if strings.Contains(s, key) {
+					t.Errorf("key in %s", s)
+				}
+			}
+		})
+	}
+}
+
+func TestConvoApiKeyNotRecorded(t *testing.T) {
+	dir := t.TempDir()
+	threads := `[{"creator": "` + testFollowing + `", "members": ["` + testAddress + `"]}]`
+	recorder := newTestFetcher(t, respond(http.StatusOK, threads), WithConvoApiKey("SECRETKEY"),
+		WithTransport(&RecordingTransport{Dir: dir}))
+	if list := recorder.processConvoConn(noRetryContext(), testAddress); list.Err != nil {
+		t.Fatalf("unexpected error: %v", list.Err)
+	}
+	infos, _ := ioutil.ReadDir(dir)
+	for _, info := range infos {
+		golden, _ := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		if strings.Contains(string(golden), "SECRETKEY") {
+			t.Errorf("key in %s", golden)
+		}
+	}
+
+	// Replaying does not need the key
+	replayer := newTestFetcher(t, respond(http.StatusInternalServerError, ""), WithConvoApiKey("OTHERKEY"),
+		WithTransport(&ReplayTransport{Dir: dir}))
+	replayer.baseURLs = recorder.baseURLs
+	if list := replayer.processConvoConn(noRetryContext(), testAddress); list.Err != nil || len(list.Conn) != 1 {
+		t.Errorf("replayed %+v, %v", list.Conn, list.Err)
+	}
+}
+
+func TestConvoWithoutApiKey(t *testing.T) {
+	for _, source := range NewFetcher().connectionSources {
+		if source.Name() == CONVO {
+			t.Error("Convo is queried without an API key")
+		}
+	}
+}
+
+// Both fetches return what the sources answered before ctx was done
+func TestFetchWithContextPartial(t *testing.T) {
+	blocked := func(ctx context.Context) {
+		<-ctx.Done()
+	}
+	f := NewFetcher(
+		WithConnectionSources(
+			NewConnectionSource("Slow", func(ctx context.Context, address string) ConnectionEntryList {
+				blocked(ctx)
+				return ConnectionEntryList{Err: ctx.Err()}
+			}),
+			NewConnectionSource("Fast", func(ctx context.Context, address string) ConnectionEntryList {
+				return ConnectionEntryList{Conn: []ConnectionEntry{{From: testAddress, To: testFollowing, Platform: "Fast"}}}
+			}),
+		),
+		WithIdentitySources(
+			NewIdentitySource("Slow", func(ctx context.Context, address string) IdentityEntry {
+				blocked(ctx)
+				return IdentityEntry{Err: ctx.Err()}
+			}),
+			NewIdentitySource("Fast", func(ctx context.Context, address string) IdentityEntry {
+				return IdentityEntry{Zora: &UserZoraIdentity{Username: "fast", DataSource: "Fast"}}
+			}),
+		),
+		WithSources("Slow", "Fast"),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	conns, err := f.FetchConnectionsWithContext(ctx, testAddress)
+	if err != context.DeadlineExceeded {
+		t.Errorf("connections err = %v", err)
+	}
+	if len(conns.Sources) != 1 || conns.Sources[0].Source != "Fast" || len(conns.Conn) != 1 || conns.Summary.Followings != 1 {
+		t.Errorf("connections = %+v", conns)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	ids, err := f.FetchIdentityWithContext(ctx, testAddress)
+	if err != context.DeadlineExceeded {
+		t.Errorf("identity err = %v", err)
+	}
+	if len(ids.Sources) != 1 || ids.Sources[0].Source != "Fast" || len(ids.Zora) != 1 {
+		t.Errorf("identity = %+v", ids)
+	}
+}
@@ -0,0 +1,156 @@
+package fetcher
+
+import (
+	"strings"
+)
+
+// PlatformConnections splits the connections of one platform by direction relative to the
+// queried address, each list holds the other endpoint's address once
+type PlatformConnections struct {
+	// Followings are the addresses followed by the queried address
+	Followings []string
+	// Followers are the addresses following the queried address
+	Followers []string
+	// Mutuals are the addresses present in both Followings and Followers
+	Mutuals []string
+}
+
+// ConnectionSummary counts the distinct addresses across all platforms, an address followed on
+// one platform and following back on another is a mutual
+type ConnectionSummary struct {
+	Followings int
+	Followers  int
+	Mutuals    int
+}
+
+// Directions of a connection relative to the queried address
+const (
+	DirectionAll       = "all"
+	DirectionFollowing = "following"
+	DirectionFollower  = "follower"
+	DirectionMutual    = "mutual"
+)
+
+// connectionEndpoint returns the lowercase endpoint of conn other than address, and whether
+// address follows it. ok is false when address is not exactly one of the endpoints.
+func connectionEndpoint(address string, conn ConnectionEntry) (other string, following bool, ok bool) {
+	from, to := strings.ToLower(conn.From), strings.ToLower(conn.To)
+	switch {
+	case from == address && to != address:
+		return to, true, true
+	case to == address && from != address:
+		return from, false, true
+	default:
+		return "", false, false
+	}
+}
+
+// splitConnections groups conns by platform and direction relative to address
+func splitConnections(address string, conns []ConnectionEntry) (map[string]*PlatformConnections, ConnectionSummary) {
+	address = strings.ToLower(address)
+	followings := make(map[string]*addressSet)
+	followers := make(map[string]*addressSet)
+	allFollowings := newAddressSet()
+	allFollowers := newAddressSet()
+
+	for _, conn := range conns {
+		if followings[conn.Platform] == nil {
+			followings[conn.Platform] = newAddressSet()
+			followers[conn.Platform] = newAddressSet()
+		}
+		other, following, ok := connectionEndpoint(address, conn)
+		switch {
+		case !ok:
+		case following:
+			followings[conn.Platform].add(other)
+			allFollowings.add(other)
+		default:
+			followers[conn.Platform].add(other)
+			allFollowers.add(other)
+		}
+	}
+
+	platforms := make(map[string]*PlatformConnections)
+	for name := range followings {
+		platforms[name] = &PlatformConnections{
+			Followings: followings[name].list,
+			Followers:  followers[name].list,
+			Mutuals:    followings[name].intersect(followers[name]),
+		}
+	}
+	summary := ConnectionSummary{
+		Followings: len(allFollowings.list),
+		Followers:  len(allFollowers.list),
+		Mutuals:    len(allFollowings.intersect(allFollowers)),
+	}
+	return platforms, summary
+}
+
+// FilterConnections keeps the conns in direction relative to address, in their order, dropping
+// those address is not an endpoint of. A mutual is an address both following and followed by
+// address in conns, whatever the platforms, like in ConnectionSummary.
+func FilterConnections(address string, conns []ConnectionEntry, direction string) []ConnectionEntry {
+	address = strings.ToLower(address)
+	followings := newAddressSet()
+	followers := newAddressSet()
+	for _, conn := range conns {
+		if other, following, ok := connectionEndpoint(address, conn); ok && following {
+			followings.add(other)
+		} else if ok {
+			followers.add(other)
+		}
+	}
+
+	var results []ConnectionEntry
+	for _, conn := range conns {
+		other, following, ok := connectionEndpoint(address, conn)
+		if !ok {
+			continue
+		}
+		switch direction {
+		case DirectionFollowing:
+			if !following {
+				continue
+			}
+		case DirectionFollower:
+			if following {
+				continue
+			}
+		case DirectionMutual:
+			if !followings.has[other] || !followers.has[other] {
+				continue
+			}
+		}
+		results = append(results, conn)
+	}
+	return results
+}
+
+// addressSet keeps distinct addresses in insertion order
+type addressSet struct {
+	has  map[string]bool
+	list []string
+}
+
+func newAddressSet() *addressSet {
+	return &addressSet{has: make(map[string]bool)}
+}
+
+func (s *addressSet) add(addr string) {
+	if s.has[addr] {
+		return
+	}
+	s.has[addr] = true
+	s.list = append(s.list, addr)
+}
+
+// intersect returns the addresses of s also in other, in the order of s
+func (s *addressSet) intersect(other *addressSet) []string {
+	var results []string
+	for _, addr := range s.list {
+		if other.has[addr] {
+			results = append(results, addr)
+		}
+	}
+	return results
+}
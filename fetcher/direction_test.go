@@ -0,0 +1,54 @@
+package fetcher
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testOther = "0x3333333333333333333333333333333333333333"
+
+func TestSplitConnections(t *testing.T) {
+	conns := []ConnectionEntry{
+		// Mutual follow on Rarible, reported twice
+		{From: testAddress, To: testFollowing, Platform: RARIBLE},
+		{From: testFollowing, To: testAddress, Platform: RARIBLE},
+		{From: testAddress, To: testFollowing, Platform: RARIBLE},
+		// One-way follows on Context, the follower reported twice
+		{From: testAddress, To: testFollower, Platform: CONTEXT},
+		{From: testOther, To: testAddress, Platform: CONTEXT},
+		{From: testOther, To: strings.ToUpper(testAddress), Platform: CONTEXT},
+		// Following back on Rarible what the address follows on Context
+		{From: testFollower, To: testAddress, Platform: RARIBLE},
+	}
+	mixedCase := "0x" + strings.ToUpper(testAddress[2:6]) + testAddress[6:]
+
+	platforms, summary := splitConnections(mixedCase, conns)
+	want := map[string]*PlatformConnections{
+		RARIBLE: {
+			Followings: []string{testFollowing},
+			Followers:  []string{testFollowing, testFollower},
+			Mutuals:    []string{testFollowing},
+		},
+		CONTEXT: {
+			Followings: []string{testFollower},
+			Followers:  []string{testOther},
+		},
+	}
+	if !reflect.DeepEqual(platforms, want) {
+		for name, got := range platforms {
+			t.Errorf("%s: got %+v, want %+v", name, got, want[name])
+		}
+	}
+	// A mutual across platforms counts in the summary
+	if summary != (ConnectionSummary{Followings: 2, Followers: 3, Mutuals: 2}) {
+		t.Errorf("summary = %+v", summary)
+	}
+}
+
+func TestSplitConnectionsEmpty(t *testing.T) {
+	platforms, summary := splitConnections(testAddress, nil)
+	if len(platforms) != 0 || summary != (ConnectionSummary{}) {
+		t.Errorf("got %+v, %+v", platforms, summary)
+	}
+}
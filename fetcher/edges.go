@@ -0,0 +1,54 @@
+package fetcher
+
+import (
+	"strings"
+	"time"
+)
+
+// ConnectionEdge is a (From, To) follow asserted by one or more platforms
+type ConnectionEdge struct {
+	From      string
+	To        string
+	Platforms []string
+	// FirstSeen is the earliest CreatedAt reported for the follow, zero if no platform reports one
+	FirstSeen time.Time
+}
+
+// Edges merges the raw entries of Conn so that every (From, To) pair appears once, with the
+// platforms asserting it in the order they were first seen
+func (r ConnectionResult) Edges() []ConnectionEdge {
+	return MergeConnections(r.Conn)
+}
+
+// MergeConnections deduplicates conns across and within platforms into an edge set
+func MergeConnections(conns []ConnectionEntry) []ConnectionEdge {
+	var edges []ConnectionEdge
+	index := make(map[[2]string]int)
+	for _, conn := range conns {
+		key := [2]string{strings.ToLower(conn.From), strings.ToLower(conn.To)}
+		i, ok := index[key]
+		if !ok {
+			i = len(edges)
+			index[key] = i
+			edges = append(edges, ConnectionEdge{From: key[0], To: key[1]})
+		}
+
+		edge := &edges[i]
+		if !containsString(edge.Platforms, conn.Platform) {
+			edge.Platforms = append(edge.Platforms, conn.Platform)
+		}
+		if !conn.CreatedAt.IsZero() && (edge.FirstSeen.IsZero() || conn.CreatedAt.Before(edge.FirstSeen)) {
+			edge.FirstSeen = conn.CreatedAt
+		}
+	}
+	return edges
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
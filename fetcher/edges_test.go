@@ -0,0 +1,48 @@
+package fetcher
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMergeConnections(t *testing.T) {
+	day := func(n int) time.Time {
+		return time.Date(2021, 6, n, 0, 0, 0, 0, time.UTC)
+	}
+	conns := []ConnectionEntry{
+		{From: testAddress, To: testFollowing, Platform: CONTEXT},
+		{From: testAddress, To: testFollowing, Platform: RARIBLE, CreatedAt: day(3)},
+		{From: testFollower, To: testAddress, Platform: CONVO, CreatedAt: day(5)},
+		// Repeated rows of one platform, in another case
+		{From: "0x" + strings.ToUpper(testAddress[2:]), To: testFollowing, Platform: RARIBLE, CreatedAt: day(2)},
+		{From: testAddress, To: testFollowing, Platform: CONTEXT},
+		{From: testFollower, To: testAddress, Platform: CONVO},
+	}
+	original := append([]ConnectionEntry(nil), conns...)
+
+	edges := MergeConnections(conns)
+	want := []ConnectionEdge{
+		{From: testAddress, To: testFollowing, Platforms: []string{CONTEXT, RARIBLE}, FirstSeen: day(2)},
+		{From: testFollower, To: testAddress, Platforms: []string{CONVO}, FirstSeen: day(5)},
+	}
+	if !reflect.DeepEqual(edges, want) {
+		t.Errorf("edges = %+v, want %+v", edges, want)
+	}
+	if !reflect.DeepEqual(conns, original) {
+		t.Errorf("conns changed to %+v", conns)
+	}
+
+	// Platforms are listed in the order they were first seen, however often the merge runs
+	if again := (ConnectionResult{Conn: conns}).Edges(); !reflect.DeepEqual(again, want) {
+		t.Errorf("edges = %+v, want %+v", again, want)
+	}
+}
+
+func TestMergeConnectionsWithoutCreatedAt(t *testing.T) {
+	edges := MergeConnections([]ConnectionEntry{{From: testAddress, To: testFollowing, Platform: CONTEXT}})
+	if len(edges) != 1 || !edges[0].FirstSeen.IsZero() {
+		t.Errorf("edges = %+v", edges)
+	}
+}
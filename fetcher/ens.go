@@ -0,0 +1,254 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	ens "github.com/wealdtech/go-ens/v3"
+	"go.uber.org/zap"
+)
+
+// Standard ENS text record keys, see EIP-634
+const (
+	EnsTextTwitter     = "com.twitter"
+	EnsTextGithub      = "com.github"
+	EnsTextUrl         = "url"
+	EnsTextEmail       = "email"
+	EnsTextAvatar      = "avatar"
+	EnsTextDescription = "description"
+)
+
+// WithEnsBackend enables on-chain ENS lookups through backend, e.g. an *ethclient.Client
+// or a simulated backend
+func WithEnsBackend(backend bind.ContractBackend) Option {
+	return func(f *fetcher) {
+		f.ensBackend = backend
+	}
+}
+
+// WithEthRPC enables on-chain ENS lookups through the JSON-RPC endpoint at url,
+// e.g. an Infura mainnet endpoint
+func WithEthRPC(url string) Option {
+	return func(f *fetcher) {
+		client, err := rpc.DialHTTPWithClient(url, f.httpClient)
+		if err != nil {
+			zap.L().With(zap.Error(err)).Error("invalid eth json-rpc endpoint: " + url)
+			return
+		}
+		f.ensBackend = ethclient.NewClient(client)
+	}
+}
+
+func (f *fetcher) processEns(ctx context.Context, address string) IdentityEntry {
+	var result IdentityEntry
+	if !isAddress(address) {
+		return result
+	}
+
+	// go-ens does not take a context, run the lookup aside so that we still return on ctx.Done()
+	var record *UserEnsIdentity
+	var err error
+	done := make(chan struct{})
+	go func() {
+		record, err = f.lookupEns(address)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		result.Err = ctx.Err()
+		result.Msg = "[processEns] ens lookup cancelled"
+		return result
+	}
+
+	if err != nil {
+		result.Err = err
+		result.Msg = "[processEns] ens lookup failed"
+		return result
+	}
+	result.Ens = record
+	return result
+}
+
+// lookupEns does a verified reverse lookup of address and reads the standard text records of
+// the name, it returns nil without error when the address has no verified primary name
+func (f *fetcher) lookupEns(address string) (*UserEnsIdentity, error) {
+	addr := common.HexToAddress(address)
+	name, err := ens.ReverseResolve(f.ensBackend, addr)
+	if err != nil {
+		if isEnsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// Anybody can claim any name in the reverse record, only trust it if the name resolves back
+	resolved, err := ens.Resolve(f.ensBackend, name)
+	if err != nil {
+		if isEnsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if resolved != addr {
+		return nil, nil
+	}
+
+	record := &UserEnsIdentity{
+		Ens:        name,
+		DataSource: ENS,
+	}
+	resolver, err := ens.NewResolver(f.ensBackend, name)
+	if err != nil {
+		return nil, err
+	}
+	for key, field := range map[string]*string{
+		EnsTextTwitter:     &record.Twitter,
+		EnsTextGithub:      &record.Github,
+		EnsTextUrl:         &record.Url,
+		EnsTextEmail:       &record.Email,
+		EnsTextAvatar:      &record.Avatar,
+		EnsTextDescription: &record.Description,
+	} {
+		// Older resolvers do not implement text records, treat them as unset
+		value, err := resolver.Text(key)
+		if err != nil {
+			continue
+		}
+		*field = value
+	}
+	return record, nil
+}
+
+const (
+	// ensCacheTTL is how long forward lookups, found or not, are kept
+	ensCacheTTL = time.Hour
+	// ensLookupWorkers caps the concurrent forward lookups of a batch
+	ensLookupWorkers = 8
+)
+
+type ensCacheEntry struct {
+	address string
+	expires time.Time
+}
+
+// ensCache keeps forward lookups of ENS names, an empty address means the name did not resolve
+type ensCache struct {
+	mu      sync.Mutex
+	entries map[string]ensCacheEntry
+}
+
+func (c *ensCache) get(name string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[name]
+	if !ok || time.Now().After(entry.expires) {
+		return "", false
+	}
+	return entry.address, true
+}
+
+func (c *ensCache) set(name, address string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]ensCacheEntry)
+	}
+	c.entries[name] = ensCacheEntry{address: address, expires: time.Now().Add(ensCacheTTL)}
+}
+
+// resolveEnsNames forward-resolves names to lowercase 0x addresses. Names that do not resolve
+// map to the empty string, names whose lookup failed or was cancelled are missing.
+func (f *fetcher) resolveEnsNames(ctx context.Context, names []string) map[string]string {
+	results := make(map[string]string)
+	var pending []string
+	for _, name := range names {
+		if address, ok := f.ensCache.get(name); ok {
+			results[name] = address
+			continue
+		}
+		pending = append(pending, name)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan string)
+	for i := 0; i < ensLookupWorkers && i < len(pending); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range queue {
+				resolved, err := ens.Resolve(f.ensBackend, name)
+				if err != nil && !isEnsNotFound(err) {
+					// Do not cache transient failures
+					zap.L().With(zap.Error(err)).Error("ens resolve failed: " + name)
+					continue
+				}
+				address := ""
+				if err == nil {
+					address = strings.ToLower(resolved.Hex())
+				}
+				f.ensCache.set(name, address)
+				mu.Lock()
+				results[name] = address
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, name := range pending {
+		select {
+		case queue <- name:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	return results
+}
+
+// ResolveAddress returns the lowercase 0x address of input, an address or an ENS name. ENS
+// names need an ENS backend, see WithEthRPC.
+func (f *fetcher) ResolveAddress(ctx context.Context, input string) (string, error) {
+	if isAddress(input) {
+		address, _, _ := f.normalizeEndpoint(input, nil)
+		return address, nil
+	}
+	if !addressFilter(input) {
+		return "", fmt.Errorf("%q is neither an address nor an ENS name", input)
+	}
+	if f.ensBackend == nil {
+		return "", fmt.Errorf("cannot resolve %q without an ENS backend", input)
+	}
+	name := strings.ToLower(input)
+	address, ok := f.resolveEnsNames(ctx, []string{name})[name]
+	if !ok {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("ens lookup of %q failed", input)
+	}
+	if address == "" {
+		return "", fmt.Errorf("%q does not resolve to an address", input)
+	}
+	return address, nil
+}
+
+// isEnsNotFound reports whether err is go-ens telling that no record exists
+func isEnsNotFound(err error) bool {
+	switch err.Error() {
+	case "no resolution", "not a resolver", "unregistered name", "no address":
+		return true
+	}
+	return strings.HasSuffix(err.Error(), bind.ErrNoCode.Error())
+}
@@ -0,0 +1,270 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	ens "github.com/wealdtech/go-ens/v3"
+	"github.com/wealdtech/go-ens/v3/contracts/registry"
+	"github.com/wealdtech/go-ens/v3/contracts/resolver"
+	"github.com/wealdtech/go-ens/v3/contracts/reverseresolver"
+)
+
+// stubCode is a contract answering every call with the return data stored for its exact
+// calldata: storage[keccak256(calldata)] holds the length, the following slots the data. Calls
+// without stored data return 64 zero bytes, i.e. the zero address or the empty string.
+var stubCode = []byte{
+	0x36, 0x60, 0x00, 0x60, 0x00, 0x37, // CALLDATACOPY(0, 0, CALLDATASIZE)
+	0x36, 0x60, 0x00, 0x20, // h = KECCAK256(0, CALLDATASIZE)
+	0x80, 0x54, // l = SLOAD(h)
+	0x80, 0x15, 0x60, 0x06, 0x1b, 0x01, // l += ISZERO(l) << 6
+	0x60, 0x00, // i = 0
+	0x5b,                                     // loop:
+	0x81, 0x81, 0x10, 0x15, 0x60, 0x2f, 0x57, // if !(i < l) goto end
+	0x80, 0x60, 0x20, 0x90, 0x04, 0x60, 0x01, 0x01, 0x83, 0x01, 0x54, // SLOAD(h + 1 + i/32)
+	0x81, 0x52, // MSTORE(i, ...)
+	0x60, 0x20, 0x01, 0x60, 0x14, 0x56, // i += 32, goto loop
+	0x5b, 0x50, 0x60, 0x00, 0xf3, // end: RETURN(0, l)
+}
+
+var (
+	ensOwner           = common.HexToAddress("0x00000000000000000000000000000000000000f0")
+	ensReverseResolver = common.HexToAddress("0x00000000000000000000000000000000000000f1")
+	ensPublicResolver  = common.HexToAddress("0x00000000000000000000000000000000000000f2")
+)
+
+// ensChain builds the genesis of a chain holding stub ENS contracts
+type ensChain struct {
+	t     *testing.T
+	alloc core.GenesisAlloc
+}
+
+func newEnsChain(t *testing.T) *ensChain {
+	registryAddress, _ := ens.RegistryContractAddress(nil)
+	c := &ensChain{t: t, alloc: core.GenesisAlloc{}}
+	for _, contract := range []common.Address{registryAddress, ensReverseResolver, ensPublicResolver} {
+		c.alloc[contract] = core.GenesisAccount{Code: stubCode, Balance: big.NewInt(0), Storage: map[common.Hash]common.Hash{}}
+	}
+	return c
+}
+
+// answer makes contract return results when method is called with args
+func (c *ensChain) answer(contract common.Address, contractABI, method string, args []interface{}, results ...interface{}) {
+	parsed, err := abi.JSON(strings.NewReader(contractABI))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	input, err := parsed.Pack(method, args...)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	output, err := parsed.Methods[method].Outputs.Pack(results...)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	storage := c.alloc[contract].Storage
+	slot := new(big.Int).SetBytes(crypto.Keccak256(input))
+	storage[common.BigToHash(slot)] = common.BigToHash(big.NewInt(int64(len(output))))
+	for i := 0; i < len(output); i += 32 {
+		slot = new(big.Int).Add(slot, big.NewInt(1))
+		storage[common.BigToHash(slot)] = common.BytesToHash(output[i : i+32])
+	}
+}
+
+func nameHash(t *testing.T, name string) [32]byte {
+	hash, err := ens.NameHash(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// register points name to address, with text records
+func (c *ensChain) register(name string, address common.Address, texts map[string]string) {
+	registryAddress, _ := ens.RegistryContractAddress(nil)
+	node := nameHash(c.t, name)
+	c.answer(registryAddress, registry.ContractABI, "owner", []interface{}{node}, ensOwner)
+	c.answer(registryAddress, registry.ContractABI, "resolver", []interface{}{node}, ensPublicResolver)
+	c.answer(ensPublicResolver, resolver.ContractABI, "addr", []interface{}{node}, address)
+	for key, value := range texts {
+		c.answer(ensPublicResolver, resolver.ContractABI, "text", []interface{}{node, key}, value)
+	}
+}
+
+// claim sets the reverse record of address to name
+func (c *ensChain) claim(address common.Address, name string) {
+	registryAddress, _ := ens.RegistryContractAddress(nil)
+	reverse := fmt.Sprintf("%x.addr.reverse", address.Bytes())
+	c.answer(registryAddress, registry.ContractABI, "resolver", []interface{}{nameHash(c.t, reverse)}, ensReverseResolver)
+	c.answer(ensReverseResolver, reverseresolver.ContractABI, "name", []interface{}{nameHash(c.t, reverse)}, name)
+}
+
+func (c *ensChain) backend() bind.ContractBackend {
+	backend := backends.NewSimulatedBackend(c.alloc, 8000000)
+	c.t.Cleanup(func() { backend.Close() })
+	return backend
+}
+
+var (
+	brantly  = common.HexToAddress("0x983110309620d911731ac0932219af06091b6744")
+	imposter = common.HexToAddress("0x00000000000000000000000000000000000000e1")
+	nobody   = common.HexToAddress("0x00000000000000000000000000000000000000e2")
+)
+
+func newEnsTestFetcher(t *testing.T) *fetcher {
+	chain := newEnsChain(t)
+	chain.register("brantly.eth", brantly, map[string]string{
+		EnsTextTwitter: "brantlymillegan",
+		EnsTextUrl:     "https://brantly.xyz",
+		EnsTextAvatar:  "eip155:1/erc721:0xb7f7f6c52f2e2fdb1963eab30438024864c313f6/2430",
+	})
+	chain.register("noaddress.eth", common.Address{}, nil)
+	chain.claim(brantly, "brantly.eth")
+	// Anybody can claim any name in their reverse record
+	chain.claim(imposter, "brantly.eth")
+	return NewFetcher(WithEnsBackend(chain.backend()))
+}
+
+func TestLookupEns(t *testing.T) {
+	f := newEnsTestFetcher(t)
+
+	record, err := f.lookupEns(brantly.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record == nil || record.Ens != "brantly.eth" || record.DataSource != ENS {
+		t.Fatalf("record = %+v", record)
+	}
+	if record.Twitter != "brantlymillegan" || record.Url != "https://brantly.xyz" || !strings.HasPrefix(record.Avatar, "eip155:1") {
+		t.Errorf("text records = %+v", record)
+	}
+	if record.Github != "" || record.Email != "" {
+		t.Errorf("unset text records = %+v", record)
+	}
+
+	for _, address := range []common.Address{imposter, nobody} {
+		record, err := f.lookupEns(address.Hex())
+		if err != nil || record != nil {
+			t.Errorf("%s: got %+v, %v, want no record", address.Hex(), record, err)
+		}
+	}
+}
+
+func TestResolveAddress(t *testing.T) {
+	f := newEnsTestFetcher(t)
+
+	address, err := f.ResolveAddress(context.Background(), "Brantly.eth")
+	if err != nil || address != strings.ToLower(brantly.Hex()) {
+		t.Errorf("got %q, %v", address, err)
+	}
+	for _, name := range []string{"nobody.eth", "noaddress.eth"} {
+		if _, err := f.ResolveAddress(context.Background(), name); err == nil || !strings.Contains(err.Error(), "does not resolve") {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+}
+
+// isEnsNotFound compares go-ens error messages, the real errors above and these pin them down
+func TestIsEnsNotFound(t *testing.T) {
+	f := newEnsTestFetcher(t)
+	_, reverseErr := ens.ReverseResolve(f.ensBackend, nobody)
+	_, unregisteredErr := ens.Resolve(f.ensBackend, "nobody.eth")
+	_, noAddressErr := ens.Resolve(f.ensBackend, "noaddress.eth")
+
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{reverseErr, true},
+		{unregisteredErr, true},
+		{noAddressErr, true},
+		{errors.New("no resolution"), true},
+		{bind.ErrNoCode, true},
+		{fmt.Errorf("call failed: %w", bind.ErrNoCode), true},
+		{errors.New("connection refused"), false},
+		{context.DeadlineExceeded, false},
+	}
+	for _, test := range tests {
+		if test.err == nil {
+			t.Errorf("go-ens did not fail")
+			continue
+		}
+		if got := isEnsNotFound(test.err); got != test.want {
+			t.Errorf("isEnsNotFound(%q) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+// brokenBackend fails every call, like an unreachable JSON-RPC endpoint
+type brokenBackend struct {
+	bind.ContractBackend
+}
+
+func (brokenBackend) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestNormalizeConnections(t *testing.T) {
+	f := newEnsTestFetcher(t)
+	conns := f.normalizeConnections(context.Background(), []ConnectionEntry{
+		{From: testAddress, To: "Brantly.eth", Platform: CONTEXT},
+		{From: testAddress, To: "nobody.eth", Platform: CONTEXT},
+	})
+	if len(conns) != 1 || conns[0].To != strings.ToLower(brantly.Hex()) || conns[0].ToEns != "brantly.eth" {
+		t.Errorf("conns = %+v", conns)
+	}
+
+	// A failed lookup says nothing about the name, the connection is kept as reported
+	f = NewFetcher(WithEnsBackend(brokenBackend{}))
+	conns = f.normalizeConnections(context.Background(), []ConnectionEntry{
+		{From: testAddress, To: "brantly.eth", Platform: CONTEXT},
+	})
+	if len(conns) != 1 || conns[0].To != "brantly.eth" || conns[0].ToEns != "" {
+		t.Errorf("conns = %+v", conns)
+	}
+	conns = f.normalizeConnections(context.Background(), []ConnectionEntry{
+		{From: testAddress, To: "Brantly.eth", Platform: CONTEXT},
+	})
+	if len(conns) != 1 || conns[0].To != "brantly.eth" {
+		t.Errorf("conns = %+v", conns)
+	}
+	if _, err := f.ResolveAddress(context.Background(), "brantly.eth"); err == nil || !strings.Contains(err.Error(), "lookup") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+// Without an ENS backend names are kept, every spelling of a name is the same endpoint
+func TestNormalizeConnectionsWithoutBackend(t *testing.T) {
+	f := NewFetcher()
+	conns := f.normalizeConnections(context.Background(), []ConnectionEntry{
+		{From: testAddress, To: "Foo.eth", Platform: CONTEXT},
+		{From: "foo.eth", To: "0x" + strings.ToUpper(testAddress[2:]), Platform: RARIBLE},
+		{From: testAddress, To: "nobody.eth", Platform: CONTEXT},
+	})
+	want := []ConnectionEntry{
+		{From: testAddress, To: "foo.eth", Platform: CONTEXT},
+		{From: "foo.eth", To: testAddress, Platform: RARIBLE},
+		{From: testAddress, To: "nobody.eth", Platform: CONTEXT},
+	}
+	if !reflect.DeepEqual(conns, want) {
+		t.Errorf("conns = %+v, want %+v", conns, want)
+	}
+
+	_, summary := splitConnections(testAddress, conns)
+	if summary != (ConnectionSummary{Followings: 2, Followers: 1, Mutuals: 1}) {
+		t.Errorf("summary = %+v", summary)
+	}
+}
@@ -1,24 +1,140 @@
 package fetcher
 
 import (
+	"context"
 	"net/http"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 )
 
 type Fetcher interface {
-	// fetch following / follower data
-	FetchConnections(address string) ([]ConnectionEntry, error)
+	// fetch following / follower data. Endpoints reported as ENS names are only turned into
+	// addresses with an ENS backend, see WithEthRPC, without one they stay lowercase names.
+	FetchConnections(address string) (ConnectionResult, error)
+	// fetch following / follower data, aborting when ctx is done
+	FetchConnectionsWithContext(ctx context.Context, address string) (ConnectionResult, error)
 	// fetch user identity data
 	FetchIdentity(address string) (IdentityEntryList, error)
+	// fetch user identity data, aborting when ctx is done
+	FetchIdentityWithContext(ctx context.Context, address string) (IdentityEntryList, error)
+	// resolve an address or ENS name to a lowercase address
+	ResolveAddress(ctx context.Context, input string) (string, error)
 }
 
 type fetcher struct {
-	httpClient *http.Client
+	httpClient        *http.Client
+	identitySources   []IdentitySource
+	connectionSources []ConnectionSource
+	sourceNames       map[string]bool
+	openSeaApiKey     string
+	ensBackend        bind.ContractBackend
+	ensCache          ensCache
+	raribleOptions    RaribleOptions
+	sybilList         sybilList
+	convoApiKey       string
+	retryPolicies     map[string]RetryPolicy
+	hostLimits        map[string]HostLimit
+	cache             Cache
+	cachePolicies     map[string]CachePolicy
+	revalidating      sync.Map
+	baseURLs          map[string]string
 }
 
 var _ Fetcher = &fetcher{}
 
-func NewFetcher() *fetcher {
-	return &fetcher{
+// Option configures a fetcher created by NewFetcher
+type Option func(*fetcher)
+
+// WithIdentitySources registers extra identity sources next to the built-in ones
+func WithIdentitySources(sources ...IdentitySource) Option {
+	return func(f *fetcher) {
+		f.identitySources = append(f.identitySources, sources...)
+	}
+}
+
+// WithConnectionSources registers extra connection sources next to the built-in ones
+func WithConnectionSources(sources ...ConnectionSource) Option {
+	return func(f *fetcher) {
+		f.connectionSources = append(f.connectionSources, sources...)
+	}
+}
+
+// WithSources restricts the fetcher to the named sources, built-in or registered,
+// e.g. WithSources(CONTEXT, RARIBLE)
+func WithSources(names ...string) Option {
+	return func(f *fetcher) {
+		if f.sourceNames == nil {
+			f.sourceNames = make(map[string]bool)
+		}
+		for _, name := range names {
+			f.sourceNames[name] = true
+		}
+	}
+}
+
+// WithOpenSeaApiKey sets the X-API-KEY header sent to the OpenSea API
+func WithOpenSeaApiKey(key string) Option {
+	return func(f *fetcher) {
+		f.openSeaApiKey = key
+	}
+}
+
+// WithConvoApiKey sets the key sent to the Convo API, Convo is only queried with a key
+func WithConvoApiKey(key string) Option {
+	return func(f *fetcher) {
+		f.convoApiKey = key
+	}
+}
+
+// RaribleOptions controls how Rarible followings and followers are paged through
+type RaribleOptions struct {
+	// PageSize is the number of connections requested per page, RaribleDefaultPageSize if 0
+	PageSize int
+	// MaxTotal caps the followings and the followers fetched per address, 0 means no cap
+	MaxTotal int
+	// MaxPages caps the pages requested for the followings and the followers of an address,
+	// RaribleDefaultMaxPages if 0
+	MaxPages int
+	// OnPage is called with every page as it arrives, it may be called from several goroutines
+	OnPage func(page []ConnectionEntry)
+}
+
+// WithRaribleOptions sets the paging of Rarible connections
+func WithRaribleOptions(options RaribleOptions) Option {
+	return func(f *fetcher) {
+		f.raribleOptions = options
+	}
+}
+
+func NewFetcher(options ...Option) *fetcher {
+	f := &fetcher{
 		httpClient: httpClient(),
 	}
+	for _, option := range options {
+		option(f)
+	}
+	if len(f.hostLimits) != 0 {
+		f.httpClient.Transport = newLimitedTransport(f.httpClient.Transport, f.hostLimits)
+	}
+	// Built-in sources depend on the options, e.g. ENS needs a backend
+	f.identitySources = append(f.builtinIdentitySources(), f.identitySources...)
+	f.connectionSources = append(f.builtinConnectionSources(), f.connectionSources...)
+
+	if f.sourceNames != nil {
+		var identitySources []IdentitySource
+		for _, source := range f.identitySources {
+			if f.sourceNames[source.Name()] {
+				identitySources = append(identitySources, source)
+			}
+		}
+		var connectionSources []ConnectionSource
+		for _, source := range f.connectionSources {
+			if f.sourceNames[source.Name()] {
+				connectionSources = append(connectionSources, source)
+			}
+		}
+		f.identitySources, f.connectionSources = identitySources, connectionSources
+	}
+	return f
 }
@@ -0,0 +1,37 @@
+package fetcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testAddress = "0x983110309620d911731ac0932219af06091b6744"
+
+// newTestFetcher returns a fetcher whose sources all talk to handler, with retries disabled
+func newTestFetcher(t *testing.T, handler http.Handler, options ...Option) *fetcher {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	for _, source := range []string{CONTEXT, SUPERRARE, OPENSEA, FOUNDATION, SHOWTIME, ZORA, RARIBLE, SYBIL, CONVO} {
+		options = append(options, WithBaseURL(source, server.URL), WithRetryPolicy(source, RetryPolicy{}))
+	}
+	return NewFetcher(options...)
+}
+
+// respond returns a handler answering every request with status and body
+func respond(status int, body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	})
+}
+
+// noRetryContext is the context of process* functions called outside of a source run, where
+// sendRequest would otherwise retry with DefaultRetryPolicy
+func noRetryContext() context.Context {
+	ctx, _ := withSourceTrace(context.Background(), RetryPolicy{})
+	return ctx
+}
@@ -0,0 +1,196 @@
+package fetcher
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WithBaseURL sends the requests of the named source to baseURL instead of the host of its
+// API constants, e.g. WithBaseURL(CONTEXT, "http://127.0.0.1:8080") for a local stub
+func WithBaseURL(source, baseURL string) Option {
+	return func(f *fetcher) {
+		if f.baseURLs == nil {
+			f.baseURLs = make(map[string]string)
+		}
+		f.baseURLs[source] = baseURL
+	}
+}
+
+// WithTransport replaces the transport of the fetcher's http client, e.g. with a
+// RecordingTransport or a ReplayTransport
+func WithTransport(transport http.RoundTripper) Option {
+	return func(f *fetcher) {
+		f.httpClient.Transport = transport
+	}
+}
+
+// sourceURL formats the API URL of source, moving it onto the source's base URL if one is set
+func (f *fetcher) sourceURL(source, format string, args ...interface{}) string {
+	raw := format
+	if len(args) != 0 {
+		raw = fmt.Sprintf(format, args...)
+	}
+	baseURL, ok := f.baseURLs[source]
+	if !ok {
+		return raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return raw
+	}
+	u.Scheme, u.Host = base.Scheme, base.Host
+	u.Path = strings.TrimSuffix(base.Path, "/") + u.Path
+	u.RawPath = ""
+	return u.String()
+}
+
+// Fixture is a recorded HTTP exchange, stored as a golden file
+type Fixture struct {
+	Method      string
+	URL         string
+	RequestBody string `json:",omitempty"`
+	StatusCode  int
+	Header      http.Header
+	Body        string
+}
+
+// secretParams are the query parameters carrying API keys, their values are not recorded
+var secretParams = []string{"apikey"}
+
+// fixtureURL is the URL of req as recorded in golden files, with the values of secretParams
+// replaced so that recording does not leak keys and replaying does not need them
+func fixtureURL(req *http.Request) string {
+	u := *req.URL
+	query := u.Query()
+	redacted := false
+	for _, param := range secretParams {
+		if query.Get(param) != "" {
+			query.Set(param, "REDACTED")
+			redacted = true
+		}
+	}
+	if redacted {
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// fixturePath names the golden file of a request after its host and a hash of method, URL and body
+func fixturePath(dir, method, rawURL string, body []byte) string {
+	sum := sha256.Sum256([]byte(method + " " + rawURL + "\n" + string(body)))
+	host := "request"
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = strings.ReplaceAll(u.Host, ":", "_")
+	}
+	return filepath.Join(dir, host+"-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// RecordingTransport sends requests through Base, http.DefaultTransport if nil, and saves every
+// response as a golden file in Dir
+type RecordingTransport struct {
+	Base http.RoundTripper
+	Dir  string
+}
+
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	fixture := Fixture{
+		Method:      req.Method,
+		URL:         fixtureURL(req),
+		RequestBody: string(reqBody),
+		StatusCode:  resp.StatusCode,
+		Header:      resp.Header,
+		Body:        string(body),
+	}
+	golden, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(fixturePath(t.Dir, req.Method, fixture.URL, reqBody), golden, 0644); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ReplayTransport answers requests with the golden files a RecordingTransport saved in Dir,
+// requests without a golden file fail
+type ReplayTransport struct {
+	Dir string
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	rawURL := fixtureURL(req)
+	path := fixturePath(t.Dir, req.Method, rawURL, reqBody)
+	golden, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("no fixture for %s %s: %w", req.Method, rawURL, err)
+	}
+	var fixture Fixture
+	if err := json.Unmarshal(golden, &fixture); err != nil {
+		return nil, fmt.Errorf("malformed fixture %s: %w", path, err)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.StatusCode, http.StatusText(fixture.StatusCode)),
+		StatusCode:    fixture.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        fixture.Header,
+		Body:          ioutil.NopCloser(strings.NewReader(fixture.Body)),
+		ContentLength: int64(len(fixture.Body)),
+		Request:       req,
+	}, nil
+}
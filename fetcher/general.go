@@ -1,10 +1,14 @@
 package fetcher
 
+import (
+	"time"
+)
+
 const (
 	RARIBLE    = "Rarible"
 	CONTEXT    = "Context"
 	CONVO      = "Convo"
-	TWITTER    = "Twtter"
+	TWITTER    = "Twitter"
 	OPENSEA    = "Opensea"
 	ZORA       = "Zora"
 	FOUNDATION = "Foundation"
@@ -12,6 +16,25 @@ const (
 	SYBIL      = "Sybil"
 	SUPERRARE  = "Superrare"
 	INFURA     = "Infura"
+	ENS        = "Ens"
+)
+
+// Social platforms that identity sources link to
+const (
+	INSTAGRAM  = "Instagram"
+	TIKTOK     = "Tiktok"
+	TWITCH     = "Twitch"
+	DISCORD    = "Discord"
+	YOUTUBE    = "Youtube"
+	FACEBOOK   = "Facebook"
+	SNAPCHAT   = "Snapchat"
+	STEEMIT    = "Steemit"
+	SPOTIFY    = "Spotify"
+	SOUNDCLOUD = "SoundCloud"
+	GITHUB     = "Github"
+	LINKTREE   = "Linktree"
+	CRYPTOART  = "CryptoArt"
+	HICETNUNC  = "Hicetnunc"
 )
 
 const (
@@ -23,22 +46,51 @@ const (
 	ContextContractAddress    = "ctx"
 )
 
+const RaribleDefaultPageSize = 1000
+
+// RaribleDefaultMaxPages bounds paging when Rarible keeps returning full pages
+const RaribleDefaultMaxPages = 100
+
 const (
 	ContextUrl          = "https://context.app/api/profile/%s"
 	SuperrareUrl        = "https://superrare.com/api/v2/user?address=%s"
+	OpenSeaUrl          = "https://api.opensea.io/api/v1/account/%s"
+	OpenSeaHomepageUrl  = "https://opensea.io/%s"
+	FoundationUrl       = "https://hasura2.foundation.app/v1/graphql"
+	ShowtimeUrl         = "https://showtime.io/api/v1/profile_server/%s"
+	ZoraUrl             = "https://zora.co/api/users/%s"
 	RaribleFollowingUrl = "https://api-mainnet.rarible.com/marketplace/api/v4/followings?owner=%s"
 	RaribleFollowerUrl  = "https://api-mainnet.rarible.com/marketplace/api/v4/followers?user=%s"
+	RaribleProfileUrl   = "https://api-mainnet.rarible.com/marketplace/api/v4/profiles/%s"
+	RaribleStatsUrl     = "https://api-mainnet.rarible.com/marketplace/api/v4/users/%s/stats"
+	RaribleHomepageUrl  = "https://rarible.com/%s"
+	SybilUrl            = "https://raw.githubusercontent.com/Uniswap/sybil-list/master/verified.json"
+	ConvoThreadsUrl     = "https://api.theconvo.space/threads?member=%s&apikey=%s"
 )
 
 type ConnectionEntryList struct {
 	Conn []ConnectionEntry
-	Err  error
+	Err  error `json:"-"`
 	msg  string
 }
+
+type ConnectionResult struct {
+	Conn []ConnectionEntry
+	// Platforms splits Conn by platform into followings, followers and mutuals
+	Platforms map[string]*PlatformConnections
+	Summary   ConnectionSummary
+	Sources   []SourceStatus
+}
+
 type ConnectionEntry struct {
 	From     string
 	To       string
 	Platform string
+	// FromEns and ToEns keep the ENS name the platform reported when From / To were resolved from it
+	FromEns string
+	ToEns   string
+	// CreatedAt is when the follow happened, zero if the platform does not tell
+	CreatedAt time.Time
 }
 
 type IdentityEntryList struct {
@@ -51,6 +103,12 @@ type IdentityEntryList struct {
 	Foundation []UserFoundationIdentity
 	Showtime   []UserShowtimeIdentity
 	Ens        string
+	EnsRecords []UserEnsIdentity
+	// Attributes records the source, fetch time and confidence of every field above
+	Attributes []IdentityAttribute
+	// Conflicts lists the fields for which sources disagree
+	Conflicts []FieldConflict
+	Sources   []SourceStatus
 }
 
 type IdentityEntry struct {
@@ -63,12 +121,15 @@ type IdentityEntry struct {
 	Ens        *UserEnsIdentity
 	Foundation *UserFoundationIdentity
 	Showtime   *UserShowtimeIdentity
-	Err        error
-	Msg        string
+	Err        error  `json:"-"`
+	Msg        string `json:"-"`
 }
 
 type UserTwitterIdentity struct {
-	Handle     string
+	Handle string
+	// Verified is set when the address owner proved the handle by signing a tweet, e.g. through Sybil
+	Verified   bool
+	TweetID    string
 	DataSource string
 }
 
@@ -81,14 +142,23 @@ type UserRaribleIdentity struct {
 }
 
 type UserOpenSeaIdentity struct {
-	Username   string
-	Homepage   string
-	DataSource string
+	Username     string
+	Homepage     string
+	ProfileImage string
+	Bio          string
+	Verified     bool
+	DataSource   string
 }
 
 type UserEnsIdentity struct {
-	Ens        string
-	DataSource string
+	Ens         string
+	Twitter     string
+	Github      string
+	Url         string
+	Email       string
+	Avatar      string
+	Description string
+	DataSource  string
 }
 
 type UserContextIdentity struct {
@@ -113,23 +183,27 @@ type UserSuperrareIdentity struct {
 }
 
 type UserFoundationIdentity struct {
-	Username   string
-	Bio        string
-	Tiktok     string
-	Twitch     string
-	Discord    string
-	Twitter    string
-	Website    string
-	Youtube    string
-	Facebook   string
-	Snapchat   string
-	Instagram  string
-	DataSource string
+	Username  string
+	Bio       string
+	Tiktok    string
+	Twitch    string
+	Discord   string
+	Twitter   string
+	Website   string
+	Youtube   string
+	Facebook  string
+	Snapchat  string
+	Instagram string
+	// TwitterVerified and InstagramVerified are set when Foundation verified the handle
+	TwitterVerified   bool
+	InstagramVerified bool
+	DataSource        string
 }
 
 type UserZoraIdentity struct {
 	Username   string
 	Website    string
+	Bio        string
 	DataSource string
 }
 
@@ -148,12 +222,33 @@ type UserShowtimeIdentity struct {
 }
 
 type RaribleConnectionResp struct {
+	Id        string `json:"id"`
 	Following struct {
 		From string `json:"owner"`
 		To   string `json:"user"`
 	} `json:"following"`
 }
 
+type RaribleProfile struct {
+	Id       string `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	ShortUrl string `json:"shortUrl"`
+}
+
+type RaribleStats struct {
+	ItemsSold int     `json:"itemsSold"`
+	VolumeEth float64 `json:"volumeEth"`
+}
+
+type SybilVerification struct {
+	Twitter struct {
+		Timestamp int64  `json:"timestamp"`
+		TweetID   string `json:"tweetID"`
+		Handle    string `json:"handle"`
+	} `json:"twitter"`
+}
+
 type ContextAppResp struct {
 	FollowerCount int               `json:"followerCount"`
 	Ens           map[string]string `json:"ens"`
@@ -166,6 +261,13 @@ type ContextAppResp struct {
 	}) `json:"profiles"`
 }
 
+type ConvoThread struct {
+	Id        string   `json:"_id"`
+	Creator   string   `json:"creator"`
+	Members   []string `json:"members"`
+	CreatedOn int64    `json:"createdOn"`
+}
+
 type ContextConnection struct {
 	Relationships []struct {
 		Actor string `json:"actor"`
@@ -189,6 +291,40 @@ type SuperrareProfile struct {
 	} `json:"result"`
 }
 
+type OpenSeaAccount struct {
+	Data struct {
+		User struct {
+			Username string `json:"username"`
+		} `json:"user"`
+		ProfileImgUrl string `json:"profile_img_url"`
+		Address       string `json:"address"`
+		Bio           string `json:"bio"`
+		Config        string `json:"config"`
+	} `json:"data"`
+}
+
+type ShowtimeProfile struct {
+	Data struct {
+		Profile struct {
+			Name     string `json:"name"`
+			Username string `json:"username"`
+			Bio      string `json:"bio"`
+			Links    []struct {
+				Name      string `json:"name"`
+				Prefix    string `json:"prefix"`
+				UserInput string `json:"user_input"`
+			} `json:"links"`
+		} `json:"profile"`
+	} `json:"data"`
+}
+
+type ZoraProfile struct {
+	Address  string `json:"address"`
+	Username string `json:"username"`
+	Website  string `json:"website"`
+	Bio      string `json:"bio"`
+}
+
 type FoundationIdentity struct {
 	Data struct {
 		User struct {
@@ -1,39 +1,51 @@
 package fetcher
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"go.uber.org/zap"
 )
 
-const IdentityApiCount = 2
-
 func (f *fetcher) FetchIdentity(address string) (IdentityEntryList, error) {
+	return f.FetchIdentityWithContext(context.Background(), address)
+}
+
+func (f *fetcher) FetchIdentityWithContext(ctx context.Context, address string) (IdentityEntryList, error) {
 
 	var identityArr IdentityEntryList
-	ch := make(chan IdentityEntry)
+	// Buffered so that source goroutines never block once we stop receiving
+	ch := make(chan identityResult, len(f.identitySources))
 
-	// Part 1 - Demo data source
-	// Context API
-	go f.processContext(address, ch)
-	// Superrare API
-	go f.processSuperrare(address, ch)
-	// Part 2 - Add other data source here
-	// TODO
+	// Part 1 - Query every registered data source
+	for _, source := range f.identitySources {
+		go func(source IdentitySource) {
+			ch <- f.runIdentitySource(ctx, source, address)
+		}(source)
+	}
 
 	// Final Part - Merge entry
-	for i := 0; i < IdentityApiCount; i++ {
-		entry := <-ch
+	for i := 0; i < len(f.identitySources); i++ {
+		var res identityResult
+		select {
+		case res = <-ch:
+		case <-ctx.Done():
+			return identityArr, ctx.Err()
+		}
+		identityArr.Sources = append(identityArr.Sources, res.status)
+
+		entry := res.entry
 		if entry.Err != nil {
 			zap.L().With(zap.Error(entry.Err)).Error("identity api error: " + entry.Msg)
 			continue
 		}
+		normalizeEntryLinks(&entry)
 		if entry.OpenSea != nil {
 			identityArr.OpenSea = append(identityArr.OpenSea, *entry.OpenSea)
 		}
-		if entry.Twitter != nil {
-			entry.Twitter.Handle = convertTwitterHandle(entry.Twitter.Handle)
+		if entry.Twitter != nil && entry.Twitter.Handle != "" {
 			identityArr.Twitter = append(identityArr.Twitter, *entry.Twitter)
 		}
 		if entry.Superrare != nil {
@@ -55,33 +67,38 @@ func (f *fetcher) FetchIdentity(address string) (IdentityEntryList, error) {
 			identityArr.Showtime = append(identityArr.Showtime, *entry.Showtime)
 		}
 		if entry.Ens != nil {
-			identityArr.Ens = entry.Ens.Ens
+			// The verified on-chain name wins over the copies of aggregators
+			if identityArr.Ens == "" || entry.Ens.DataSource == ENS {
+				identityArr.Ens = entry.Ens.Ens
+			}
+			identityArr.EnsRecords = append(identityArr.EnsRecords, *entry.Ens)
 		}
+		identityArr.Attributes = append(identityArr.Attributes, entryAttributes(entry, res.status.FetchedAt)...)
 	}
+	identityArr.Zora = preferZoraIdentity(identityArr.Zora)
+	identityArr.Conflicts = findConflicts(identityArr.Attributes)
 
-	return identityArr, nil
+	return identityArr, partialResultError(identityArr.Sources)
 }
 
-func (f *fetcher) processContext(address string, ch chan<- IdentityEntry) {
+func (f *fetcher) processContext(ctx context.Context, address string) IdentityEntry {
 	var result IdentityEntry
 
-	body, err := sendRequest(f.httpClient, RequestArgs{
-		url:    fmt.Sprintf(ContextUrl, address),
+	body, err := sendRequest(ctx, f.httpClient, RequestArgs{
+		url:    f.sourceURL(CONTEXT, ContextUrl, address),
 		method: "GET",
 	})
 	if err != nil {
 		result.Err = err
 		result.Msg = "[processContext] fetch identity failed"
-		ch <- result
-		return
+		return result
 	}
 	contextProfile := ContextAppResp{}
 	err = json.Unmarshal(body, &contextProfile)
 	if err != nil {
 		result.Err = err
 		result.Msg = "[processContext] identity response json unmarshal failed"
-		ch <- result
-		return
+		return result
 	}
 
 	if value, ok := contextProfile.Ens[address]; ok {
@@ -136,31 +153,28 @@ func (f *fetcher) processContext(address string, ch chan<- IdentityEntry) {
 		}
 	}
 
-	ch <- result
-	return
+	return result
 }
 
-func (f *fetcher) processSuperrare(address string, ch chan<- IdentityEntry) {
+func (f *fetcher) processSuperrare(ctx context.Context, address string) IdentityEntry {
 	var result IdentityEntry
 
-	body, err := sendRequest(f.httpClient, RequestArgs{
-		url:    fmt.Sprintf(SuperrareUrl, address),
+	body, err := sendRequest(ctx, f.httpClient, RequestArgs{
+		url:    f.sourceURL(SUPERRARE, SuperrareUrl, address),
 		method: "GET",
 	})
 	if err != nil {
 		result.Err = err
 		result.Msg = "[processSuperrare] fetch identity failed"
-		ch <- result
-		return
+		return result
 	}
 
 	sprProfile := SuperrareProfile{}
 	err = json.Unmarshal(body, &sprProfile)
 	if err != nil {
 		result.Err = err
-		result.Msg = "[processSuperrare] identity response json unmarshal failednti"
-		ch <- result
-		return
+		result.Msg = "[processSuperrare] identity response json unmarshal failed"
+		return result
 	}
 
 	newSprRecord := UserSuperrareIdentity{
@@ -182,5 +196,328 @@ func (f *fetcher) processSuperrare(address string, ch chan<- IdentityEntry) {
 		result.Superrare = &newSprRecord
 	}
 
-	ch <- result
+	return result
+}
+
+func (f *fetcher) processOpenSea(ctx context.Context, address string) IdentityEntry {
+	var result IdentityEntry
+
+	header := map[string]string{}
+	if f.openSeaApiKey != "" {
+		header["X-API-KEY"] = f.openSeaApiKey
+	}
+	body, err := sendRequest(ctx, f.httpClient, RequestArgs{
+		url:    f.sourceURL(OPENSEA, OpenSeaUrl, address),
+		method: "GET",
+		header: header,
+	})
+	if isNotFound(err) {
+		// No profile on the platform
+		return result
+	}
+	if err != nil {
+		result.Err = err
+		result.Msg = "[processOpenSea] fetch identity failed"
+		return result
+	}
+
+	account := OpenSeaAccount{}
+	err = json.Unmarshal(body, &account)
+	if err != nil {
+		result.Err = err
+		result.Msg = "[processOpenSea] identity response json unmarshal failed"
+		return result
+	}
+
+	newOpenSeaRecord := UserOpenSeaIdentity{
+		Username:     account.Data.User.Username,
+		ProfileImage: account.Data.ProfileImgUrl,
+		Bio:          account.Data.Bio,
+		Verified:     account.Data.Config == "verified",
+		DataSource:   OPENSEA,
+	}
+	if newOpenSeaRecord.Username != "" {
+		newOpenSeaRecord.Homepage = fmt.Sprintf(OpenSeaHomepageUrl, newOpenSeaRecord.Username)
+	}
+
+	// OpenSea hands out a generated profile image to every address, so it alone is no profile
+	if newOpenSeaRecord.Username != "" || newOpenSeaRecord.Bio != "" || newOpenSeaRecord.Verified {
+		result.OpenSea = &newOpenSeaRecord
+	}
+
+	return result
+}
+
+const foundationUserQuery = `query userProfileByPublicKey($publicKey: String!) {
+  user: user_by_pk(publicKey: $publicKey) {
+    username
+    bio
+    links
+    twitSocialVerifs: socialVerifications(where: {isValid: {_eq: true}, service: {_eq: "TWITTER"}}, limit: 1) {
+      username
+    }
+    instaSocialVerifs: socialVerifications(where: {isValid: {_eq: true}, service: {_eq: "INSTAGRAM"}}, limit: 1) {
+      username
+    }
+  }
+}`
+
+func (f *fetcher) processFoundation(ctx context.Context, address string) IdentityEntry {
+	var result IdentityEntry
+
+	postBody, _ := json.Marshal(map[string]interface{}{
+		"query": foundationUserQuery,
+		"variables": map[string]string{
+			"publicKey": address,
+		},
+	})
+	body, err := sendRequest(ctx, f.httpClient, RequestArgs{
+		url:    f.sourceURL(FOUNDATION, FoundationUrl),
+		method: "POST",
+		body:   postBody,
+	})
+	if err != nil {
+		result.Err = err
+		result.Msg = "[processFoundation] fetch identity failed"
+		return result
+	}
+
+	fdnProfile := FoundationIdentity{}
+	err = json.Unmarshal(body, &fdnProfile)
+	if err != nil {
+		result.Err = err
+		result.Msg = "[processFoundation] identity response json unmarshal failed"
+		return result
+	}
+
+	user := fdnProfile.Data.User
+	newFdnRecord := UserFoundationIdentity{
+		Username:   user.Username,
+		Bio:        user.Bio,
+		Tiktok:     user.Links.Tiktok.Handle,
+		Twitch:     user.Links.Twitch.Handle,
+		Discord:    user.Links.Discord.Handle,
+		Twitter:    user.Links.Twitter.Handle,
+		Website:    user.Links.Website.Handle,
+		Youtube:    user.Links.Youtube.Handle,
+		Facebook:   user.Links.Facebook.Handle,
+		Snapchat:   user.Links.Snapchat.Handle,
+		Instagram:  user.Links.Instagram.Handle,
+		DataSource: FOUNDATION,
+	}
+	// Prefer the handles Foundation verified over the self-reported links
+	if len(user.TwitSocialVerifs) != 0 && user.TwitSocialVerifs[0].Username != "" {
+		newFdnRecord.Twitter = user.TwitSocialVerifs[0].Username
+		newFdnRecord.TwitterVerified = true
+	}
+	if len(user.InstaSocialVerifs) != 0 && user.InstaSocialVerifs[0].Username != "" {
+		newFdnRecord.Instagram = user.InstaSocialVerifs[0].Username
+		newFdnRecord.InstagramVerified = true
+	}
+
+	if newFdnRecord != (UserFoundationIdentity{DataSource: FOUNDATION}) {
+		result.Foundation = &newFdnRecord
+	}
+
+	return result
+}
+
+func (f *fetcher) processShowtime(ctx context.Context, address string) IdentityEntry {
+	var result IdentityEntry
+
+	body, err := sendRequest(ctx, f.httpClient, RequestArgs{
+		url:    f.sourceURL(SHOWTIME, ShowtimeUrl, address),
+		method: "GET",
+	})
+	if isNotFound(err) {
+		// No profile on the platform
+		return result
+	}
+	if err != nil {
+		result.Err = err
+		result.Msg = "[processShowtime] fetch identity failed"
+		return result
+	}
+
+	showtimeProfile := ShowtimeProfile{}
+	err = json.Unmarshal(body, &showtimeProfile)
+	if err != nil {
+		result.Err = err
+		result.Msg = "[processShowtime] identity response json unmarshal failed"
+		return result
+	}
+
+	profile := showtimeProfile.Data.Profile
+	newShowtimeRecord := UserShowtimeIdentity{
+		Name:       profile.Name,
+		Username:   profile.Username,
+		Bio:        profile.Bio,
+		DataSource: SHOWTIME,
+	}
+	for _, link := range profile.Links {
+		handle := strings.TrimSpace(link.UserInput)
+		if handle == "" {
+			continue
+		}
+		switch strings.ToLower(link.Name) {
+		case "twitter":
+			newShowtimeRecord.TwitterHandle = handle
+		case "linktree":
+			newShowtimeRecord.LinkTreeHandle = handle
+		case "cryptoart", "cryptoart.ai":
+			newShowtimeRecord.CryptoArtHandle = handle
+		case "foundation":
+			newShowtimeRecord.FoundationHandle = handle
+		case "hic et nunc", "hicetnunc":
+			newShowtimeRecord.HicetnuncHandle = handle
+		case "opensea":
+			newShowtimeRecord.OpenseaHandle = handle
+		case "rarible":
+			newShowtimeRecord.RaribleHandle = handle
+		default:
+		}
+	}
+
+	if newShowtimeRecord != (UserShowtimeIdentity{DataSource: SHOWTIME}) {
+		result.Showtime = &newShowtimeRecord
+	}
+	// Showtime links to other platforms, surface the Twitter handle like any Twitter source
+	if newShowtimeRecord.TwitterHandle != "" {
+		result.Twitter = &UserTwitterIdentity{
+			Handle:     newShowtimeRecord.TwitterHandle,
+			DataSource: SHOWTIME,
+		}
+	}
+
+	return result
+}
+
+func (f *fetcher) processZora(ctx context.Context, address string) IdentityEntry {
+	var result IdentityEntry
+
+	body, err := sendRequest(ctx, f.httpClient, RequestArgs{
+		url:    f.sourceURL(ZORA, ZoraUrl, address),
+		method: "GET",
+	})
+	if isNotFound(err) {
+		// No profile on the platform
+		return result
+	}
+	if err != nil {
+		result.Err = err
+		result.Msg = "[processZora] fetch identity failed"
+		return result
+	}
+
+	zoraProfile := ZoraProfile{}
+	err = json.Unmarshal(body, &zoraProfile)
+	if err != nil {
+		result.Err = err
+		result.Msg = "[processZora] identity response json unmarshal failed"
+		return result
+	}
+
+	newZoraRecord := UserZoraIdentity{
+		Username:   zoraProfile.Username,
+		Website:    zoraProfile.Website,
+		Bio:        zoraProfile.Bio,
+		DataSource: ZORA,
+	}
+	if newZoraRecord.Username != "" || newZoraRecord.Website != "" || newZoraRecord.Bio != "" {
+		result.Zora = &newZoraRecord
+	}
+
+	return result
+}
+
+func (f *fetcher) processRarible(ctx context.Context, address string) IdentityEntry {
+	var result IdentityEntry
+
+	body, err := sendRequest(ctx, f.httpClient, RequestArgs{
+		url:    f.sourceURL(RARIBLE, RaribleProfileUrl, address),
+		method: "GET",
+	})
+	if isNotFound(err) {
+		// No profile on the platform
+		return result
+	}
+	if err != nil {
+		result.Err = err
+		result.Msg = "[processRarible] fetch identity failed"
+		return result
+	}
+
+	rarProfile := RaribleProfile{}
+	err = json.Unmarshal(body, &rarProfile)
+	if err != nil {
+		result.Err = err
+		result.Msg = "[processRarible] identity response json unmarshal failed"
+		return result
+	}
+
+	body, err = sendRequest(ctx, f.httpClient, RequestArgs{
+		url:    f.sourceURL(RARIBLE, RaribleStatsUrl, address),
+		method: "GET",
+	})
+	if err != nil && !isNotFound(err) {
+		result.Err = err
+		result.Msg = "[processRarible] fetch sales stats failed"
+		return result
+	}
+
+	// Users without stats have sold nothing
+	rarStats := RaribleStats{}
+	if err == nil {
+		err = json.Unmarshal(body, &rarStats)
+		if err != nil {
+			result.Err = err
+			result.Msg = "[processRarible] sales stats response json unmarshal failed"
+			return result
+		}
+	}
+
+	newRarRecord := UserRaribleIdentity{
+		Username:        rarProfile.Username,
+		ItemSold:        rarStats.ItemsSold,
+		AmountSoldInEth: rarStats.VolumeEth,
+		DataSource:      RARIBLE,
+	}
+	if newRarRecord.Username == "" {
+		newRarRecord.Username = rarProfile.Name
+	}
+	if rarProfile.ShortUrl != "" {
+		newRarRecord.Homepage = fmt.Sprintf(RaribleHomepageUrl, rarProfile.ShortUrl)
+	}
+
+	if newRarRecord.Username != "" || newRarRecord.ItemSold != 0 {
+		result.Rarible = &newRarRecord
+	}
+
+	return result
+}
+
+// preferZoraIdentity moves the record from Zora's own API to the front, so that Zora[0] is the
+// Zora identity as Zora reports it. Records are kept as they are, each credits its own source.
+func preferZoraIdentity(ids []UserZoraIdentity) []UserZoraIdentity {
+	for i := range ids {
+		if ids[i].DataSource == ZORA {
+			results := append([]UserZoraIdentity{ids[i]}, ids[:i]...)
+			return append(results, ids[i+1:]...)
+		}
+	}
+	return ids
+}
+
+// count returns the number of identity records carried by the entry
+func (e IdentityEntry) count() int {
+	count := 0
+	for _, found := range []bool{
+		e.OpenSea != nil, e.Twitter != nil, e.Superrare != nil, e.Rarible != nil, e.Context != nil,
+		e.Zora != nil, e.Ens != nil, e.Foundation != nil, e.Showtime != nil,
+	} {
+		if found {
+			count++
+		}
+	}
+	return count
 }
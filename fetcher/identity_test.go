@@ -0,0 +1,480 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestProcessContext(t *testing.T) {
+	var path string
+	f := newTestFetcher(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{
+			"followerCount": 42,
+			"ens": {"` + testAddress + `": "brantly.eth"},
+			"profiles": {
+				"brantly": [
+					{"contract": "` + SuperrareContractAddress + `", "url": "https://superrare.com/brantly", "username": "brantly"},
+					{"contract": "` + ZoraContractAddress + `", "website": "https://zora.co/brantly", "username": "brantly-zora"},
+					{"contract": "` + ContextContractAddress + `", "website": "https://brantly.xyz", "username": "brantly"},
+					{"contract": "0x0000000000000000000000000000000000000000", "username": "ignored"}
+				]
+			}
+		}`))
+	}))
+
+	entry := f.processContext(noRetryContext(), testAddress)
+	if entry.Err != nil {
+		t.Fatalf("unexpected error: %v", entry.Err)
+	}
+	if path != "/api/profile/"+testAddress {
+		t.Errorf("requested path %q", path)
+	}
+	if entry.Ens == nil || entry.Ens.Ens != "brantly.eth" || entry.Ens.DataSource != CONTEXT {
+		t.Errorf("ens = %+v", entry.Ens)
+	}
+	if entry.Superrare == nil || entry.Superrare.Username != "brantly" || entry.Superrare.Homepage != "https://superrare.com/brantly" {
+		t.Errorf("superrare = %+v", entry.Superrare)
+	}
+	if entry.Zora == nil || entry.Zora.Username != "brantly-zora" || entry.Zora.Website != "https://zora.co/brantly" {
+		t.Errorf("zora = %+v", entry.Zora)
+	}
+	if entry.Context == nil || entry.Context.FollowerCount != 42 || entry.Context.Website != "https://brantly.xyz" {
+		t.Errorf("context = %+v", entry.Context)
+	}
+	if entry.OpenSea != nil || entry.Rarible != nil || entry.Foundation != nil {
+		t.Errorf("unexpected records: %+v", entry)
+	}
+}
+
+func TestProcessContextErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.Handler
+		msg     string
+	}{
+		{"http error", respond(http.StatusInternalServerError, ""), "[processContext] fetch identity failed"},
+		{"malformed json", respond(http.StatusOK, `{"profiles": [`), "[processContext] identity response json unmarshal failed"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newTestFetcher(t, test.handler)
+			entry := f.processContext(noRetryContext(), testAddress)
+			if entry.Err == nil {
+				t.Fatal("expected an error")
+			}
+			if entry.Msg != test.msg {
+				t.Errorf("msg = %q, want %q", entry.Msg, test.msg)
+			}
+		})
+	}
+}
+
+func TestProcessSuperrare(t *testing.T) {
+	var query string
+	f := newTestFetcher(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("address")
+		w.Write([]byte(`{"result": {
+			"username": "brantly",
+			"location": "NYC",
+			"bio": "ens",
+			"twitterLink": "https://twitter.com/brantlymillegan",
+			"instagramLink": "instagram.com/brantly"
+		}}`))
+	}))
+
+	entry := f.processSuperrare(noRetryContext(), testAddress)
+	if entry.Err != nil {
+		t.Fatalf("unexpected error: %v", entry.Err)
+	}
+	if query != testAddress {
+		t.Errorf("requested address %q", query)
+	}
+	want := UserSuperrareIdentity{
+		Username:      "brantly",
+		Location:      "NYC",
+		Bio:           "ens",
+		TwitterLink:   "https://twitter.com/brantlymillegan",
+		InstagramLink: "instagram.com/brantly",
+		DataSource:    SUPERRARE,
+	}
+	if entry.Superrare == nil || *entry.Superrare != want {
+		t.Errorf("superrare = %+v, want %+v", entry.Superrare, want)
+	}
+}
+
+func TestProcessSuperrareEmptyProfile(t *testing.T) {
+	f := newTestFetcher(t, respond(http.StatusOK, `{"result": {}}`))
+	entry := f.processSuperrare(noRetryContext(), testAddress)
+	if entry.Err != nil {
+		t.Fatalf("unexpected error: %v", entry.Err)
+	}
+	if entry.Superrare != nil {
+		t.Errorf("superrare = %+v, want none", entry.Superrare)
+	}
+}
+
+func TestProcessSuperrareErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.Handler
+		msg     string
+	}{
+		{"http error", respond(http.StatusNotFound, ""), "[processSuperrare] fetch identity failed"},
+		{"malformed json", respond(http.StatusOK, `not json`), "[processSuperrare] identity response json unmarshal failed"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newTestFetcher(t, test.handler)
+			entry := f.processSuperrare(noRetryContext(), testAddress)
+			if entry.Err == nil {
+				t.Fatal("expected an error")
+			}
+			if entry.Msg != test.msg {
+				t.Errorf("msg = %q, want %q", entry.Msg, test.msg)
+			}
+		})
+	}
+}
+
+func TestFetchIdentityPartialResult(t *testing.T) {
+	f := newTestFetcher(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v2/user" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"ens": {"` + testAddress + `": "brantly.eth"}}`))
+	}), WithSources(CONTEXT, SUPERRARE))
+
+	ids, err := f.FetchIdentity(testAddress)
+	var partial *PartialResultError
+	if !errors.As(err, &partial) {
+		t.Fatalf("err = %v, want *PartialResultError", err)
+	}
+	if failed := partial.FailedSources(); len(failed) != 1 || failed[0] != SUPERRARE {
+		t.Errorf("failed sources = %v", failed)
+	}
+	if partial.Failed[0].StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status code = %d", partial.Failed[0].StatusCode)
+	}
+	if ids.Ens != "brantly.eth" {
+		t.Errorf("ens = %q", ids.Ens)
+	}
+	if len(ids.Sources) != 2 {
+		t.Errorf("sources = %+v", ids.Sources)
+	}
+}
+
+func TestPreferZoraIdentity(t *testing.T) {
+	ids := preferZoraIdentity([]UserZoraIdentity{
+		{Username: "brantly-zora", Website: "https://zora.co/brantly", DataSource: CONTEXT},
+		{Bio: "from zora", DataSource: ZORA},
+	})
+	if len(ids) != 2 || ids[0].DataSource != ZORA || ids[1].DataSource != CONTEXT {
+		t.Fatalf("order = %+v", ids)
+	}
+	// Context's values must not be credited to Zora
+	if ids[0].Username != "" || ids[0].Website != "" || ids[0].Bio != "from zora" {
+		t.Errorf("zora record = %+v", ids[0])
+	}
+}
+
+// An unknown user is no profile, not a failure of the source
+func TestProcessNotFound(t *testing.T) {
+	f := newTestFetcher(t, respond(http.StatusNotFound, `{"message": "not found"}`))
+	for name, process := range map[string]func(ctx context.Context, address string) IdentityEntry{
+		OPENSEA:  f.processOpenSea,
+		SHOWTIME: f.processShowtime,
+		ZORA:     f.processZora,
+		RARIBLE:  f.processRarible,
+	} {
+		entry := process(noRetryContext(), testAddress)
+		if entry.Err != nil || entry.count() != 0 {
+			t.Errorf("%s: got %+v", name, entry)
+		}
+	}
+}
+
+func TestProcessRaribleWithoutStats(t *testing.T) {
+	f := newTestFetcher(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/stats") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"username": "brantly", "shortUrl": "brantly"}`))
+	}))
+
+	entry := f.processRarible(noRetryContext(), testAddress)
+	if entry.Err != nil {
+		t.Fatalf("unexpected error: %v", entry.Err)
+	}
+	if entry.Rarible == nil || entry.Rarible.Username != "brantly" || entry.Rarible.ItemSold != 0 {
+		t.Errorf("rarible = %+v", entry.Rarible)
+	}
+}
+
+type processErrorTest struct {
+	name    string
+	handler http.Handler
+	msg     string
+}
+
+// testProcessErrors checks that process fails with the message of each test
+func testProcessErrors(t *testing.T, process func(f *fetcher) IdentityEntry, tests []processErrorTest) {
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entry := process(newTestFetcher(t, test.handler))
+			if entry.Err == nil {
+				t.Fatalf("expected an error, got %+v", entry)
+			}
+			if entry.Msg != test.msg {
+				t.Errorf("msg = %q, want %q", entry.Msg, test.msg)
+			}
+		})
+	}
+}
+
+func TestProcessOpenSea(t *testing.T) {
+	var path, apiKey string
+	f := newTestFetcher(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		apiKey = r.Header.Get("X-API-KEY")
+		w.Write([]byte(`{"data": {
+			"user": {"username": "brantly"},
+			"profile_img_url": "https://storage.opensea.io/brantly.png",
+			"bio": "ens",
+			"config": "verified"
+		}}`))
+	}), WithOpenSeaApiKey("key"))
+
+	entry := f.processOpenSea(noRetryContext(), testAddress)
+	if entry.Err != nil {
+		t.Fatalf("unexpected error: %v", entry.Err)
+	}
+	if path != "/api/v1/account/"+testAddress || apiKey != "key" {
+		t.Errorf("requested path %q with api key %q", path, apiKey)
+	}
+	want := UserOpenSeaIdentity{
+		Username:     "brantly",
+		Homepage:     "https://opensea.io/brantly",
+		ProfileImage: "https://storage.opensea.io/brantly.png",
+		Bio:          "ens",
+		Verified:     true,
+		DataSource:   OPENSEA,
+	}
+	if entry.OpenSea == nil || *entry.OpenSea != want {
+		t.Errorf("opensea = %+v, want %+v", entry.OpenSea, want)
+	}
+
+	// Every address has a generated profile image
+	f = newTestFetcher(t, respond(http.StatusOK, `{"data": {"user": null, "profile_img_url": "https://storage.opensea.io/0.png"}}`))
+	if entry := f.processOpenSea(noRetryContext(), testAddress); entry.Err != nil || entry.OpenSea != nil {
+		t.Errorf("got %+v for an address without profile", entry)
+	}
+}
+
+func TestProcessOpenSeaErrors(t *testing.T) {
+	testProcessErrors(t, func(f *fetcher) IdentityEntry {
+		return f.processOpenSea(noRetryContext(), testAddress)
+	}, []processErrorTest{
+		{"http error", respond(http.StatusInternalServerError, ""), "[processOpenSea] fetch identity failed"},
+		{"malformed json", respond(http.StatusOK, `{"data": []}`), "[processOpenSea] identity response json unmarshal failed"},
+	})
+}
+
+func TestProcessFoundation(t *testing.T) {
+	var request struct {
+		Query     string
+		Variables map[string]string
+	}
+	f := newTestFetcher(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Write([]byte(`{"data": {"user": {
+			"username": "brantly",
+			"bio": "ens",
+			"links": {"twitter": {"handle": "self-reported"}, "website": {"handle": "brantly.xyz"}, "instagram": {"handle": "brantly"}},
+			"twitSocialVerifs": [{"username": "brantlymillegan"}],
+			"instaSocialVerifs": []
+		}}}`))
+	}))
+
+	entry := f.processFoundation(noRetryContext(), testAddress)
+	if entry.Err != nil {
+		t.Fatalf("unexpected error: %v", entry.Err)
+	}
+	if request.Variables["publicKey"] != testAddress || request.Query != foundationUserQuery {
+		t.Errorf("request = %+v", request)
+	}
+	want := UserFoundationIdentity{
+		Username:        "brantly",
+		Bio:             "ens",
+		Twitter:         "brantlymillegan",
+		TwitterVerified: true,
+		Website:         "brantly.xyz",
+		Instagram:       "brantly",
+		DataSource:      FOUNDATION,
+	}
+	if entry.Foundation == nil || *entry.Foundation != want {
+		t.Errorf("foundation = %+v, want %+v", entry.Foundation, want)
+	}
+
+	f = newTestFetcher(t, respond(http.StatusOK, `{"data": {"user": null}}`))
+	if entry := f.processFoundation(noRetryContext(), testAddress); entry.Err != nil || entry.Foundation != nil {
+		t.Errorf("got %+v for an address without profile", entry)
+	}
+}
+
+func TestProcessFoundationErrors(t *testing.T) {
+	testProcessErrors(t, func(f *fetcher) IdentityEntry {
+		return f.processFoundation(noRetryContext(), testAddress)
+	}, []processErrorTest{
+		{"http error", respond(http.StatusBadRequest, ""), "[processFoundation] fetch identity failed"},
+		{"malformed json", respond(http.StatusOK, `{"data": {"user": {"links": []}}}`), "[processFoundation] identity response json unmarshal failed"},
+	})
+}
+
+func TestProcessShowtime(t *testing.T) {
+	var path string
+	f := newTestFetcher(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{"data": {"profile": {
+			"name": "Brantly Millegan",
+			"username": "brantly",
+			"bio": "ens",
+			"links": [
+				{"name": "Twitter", "user_input": " brantlymillegan "},
+				{"name": "Hic et Nunc", "user_input": "tz1brantly"},
+				{"name": "OpenSea", "user_input": ""},
+				{"name": "Unknown", "user_input": "ignored"}
+			]
+		}}}`))
+	}))
+
+	entry := f.processShowtime(noRetryContext(), testAddress)
+	if entry.Err != nil {
+		t.Fatalf("unexpected error: %v", entry.Err)
+	}
+	if path != "/api/v1/profile_server/"+testAddress {
+		t.Errorf("requested path %q", path)
+	}
+	want := UserShowtimeIdentity{
+		Name:            "Brantly Millegan",
+		Username:        "brantly",
+		Bio:             "ens",
+		TwitterHandle:   "brantlymillegan",
+		HicetnuncHandle: "tz1brantly",
+		DataSource:      SHOWTIME,
+	}
+	if entry.Showtime == nil || *entry.Showtime != want {
+		t.Errorf("showtime = %+v, want %+v", entry.Showtime, want)
+	}
+	if entry.Twitter == nil || entry.Twitter.Handle != "brantlymillegan" || entry.Twitter.DataSource != SHOWTIME {
+		t.Errorf("twitter = %+v", entry.Twitter)
+	}
+}
+
+func TestProcessShowtimeErrors(t *testing.T) {
+	testProcessErrors(t, func(f *fetcher) IdentityEntry {
+		return f.processShowtime(noRetryContext(), testAddress)
+	}, []processErrorTest{
+		{"http error", respond(http.StatusBadGateway, ""), "[processShowtime] fetch identity failed"},
+		{"malformed json", respond(http.StatusOK, `{"data": {"profile": {"links": {}}}}`), "[processShowtime] identity response json unmarshal failed"},
+	})
+}
+
+func TestProcessZora(t *testing.T) {
+	var path string
+	f := newTestFetcher(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{"address": "` + testAddress + `", "username": "brantly", "website": "https://brantly.xyz", "bio": "ens"}`))
+	}))
+
+	entry := f.processZora(noRetryContext(), testAddress)
+	if entry.Err != nil {
+		t.Fatalf("unexpected error: %v", entry.Err)
+	}
+	if path != "/api/users/"+testAddress {
+		t.Errorf("requested path %q", path)
+	}
+	want := UserZoraIdentity{Username: "brantly", Website: "https://brantly.xyz", Bio: "ens", DataSource: ZORA}
+	if entry.Zora == nil || *entry.Zora != want {
+		t.Errorf("zora = %+v, want %+v", entry.Zora, want)
+	}
+
+	f = newTestFetcher(t, respond(http.StatusOK, `{"address": "`+testAddress+`"}`))
+	if entry := f.processZora(noRetryContext(), testAddress); entry.Err != nil || entry.Zora != nil {
+		t.Errorf("got %+v for an address without profile", entry)
+	}
+}
+
+func TestProcessZoraErrors(t *testing.T) {
+	testProcessErrors(t, func(f *fetcher) IdentityEntry {
+		return f.processZora(noRetryContext(), testAddress)
+	}, []processErrorTest{
+		{"http error", respond(http.StatusInternalServerError, ""), "[processZora] fetch identity failed"},
+		{"malformed json", respond(http.StatusOK, `<html>`), "[processZora] identity response json unmarshal failed"},
+	})
+}
+
+func TestProcessRarible(t *testing.T) {
+	var paths []string
+	f := newTestFetcher(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/stats") {
+			w.Write([]byte(`{"itemsSold": 3, "volumeEth": 1.5}`))
+			return
+		}
+		w.Write([]byte(`{"id": "` + testAddress + `", "name": "Brantly", "shortUrl": "brantly"}`))
+	}))
+
+	entry := f.processRarible(noRetryContext(), testAddress)
+	if entry.Err != nil {
+		t.Fatalf("unexpected error: %v", entry.Err)
+	}
+	wantPaths := []string{
+		"/marketplace/api/v4/profiles/" + testAddress,
+		"/marketplace/api/v4/users/" + testAddress + "/stats",
+	}
+	if strings.Join(paths, " ") != strings.Join(wantPaths, " ") {
+		t.Errorf("requested paths %v", paths)
+	}
+	// The name stands in for a missing username
+	want := UserRaribleIdentity{
+		Username:        "Brantly",
+		Homepage:        "https://rarible.com/brantly",
+		ItemSold:        3,
+		AmountSoldInEth: 1.5,
+		DataSource:      RARIBLE,
+	}
+	if entry.Rarible == nil || *entry.Rarible != want {
+		t.Errorf("rarible = %+v, want %+v", entry.Rarible, want)
+	}
+}
+
+// raribleIdentityHandler answers profile requests with profile and stats requests with stats
+func raribleIdentityHandler(profile, stats http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/stats") {
+			stats.ServeHTTP(w, r)
+			return
+		}
+		profile.ServeHTTP(w, r)
+	})
+}
+
+func TestProcessRaribleErrors(t *testing.T) {
+	profile := respond(http.StatusOK, `{"username": "brantly"}`)
+	stats := respond(http.StatusOK, `{"itemsSold": 1}`)
+	testProcessErrors(t, func(f *fetcher) IdentityEntry {
+		return f.processRarible(noRetryContext(), testAddress)
+	}, []processErrorTest{
+		{"profile http error", raribleIdentityHandler(respond(http.StatusInternalServerError, ""), stats), "[processRarible] fetch identity failed"},
+		{"profile malformed json", raribleIdentityHandler(respond(http.StatusOK, `[]`), stats), "[processRarible] identity response json unmarshal failed"},
+		{"stats http error", raribleIdentityHandler(profile, respond(http.StatusInternalServerError, "")), "[processRarible] fetch sales stats failed"},
+		{"stats malformed json", raribleIdentityHandler(profile, respond(http.StatusOK, `{"itemsSold": "1"}`)), "[processRarible] sales stats response json unmarshal failed"},
+	})
+}
@@ -0,0 +1,235 @@
+package fetcher
+
+import (
+	"sort"
+	"strings"
+)
+
+// DefaultSourcePriority ranks data sources from most to least trusted when building a MergedProfile,
+// first-party APIs come before the copies of aggregators like Context.app
+var DefaultSourcePriority = []string{
+	SUPERRARE, FOUNDATION, ZORA, OPENSEA, RARIBLE, SHOWTIME, ENS, SYBIL, CONTEXT,
+}
+
+// MergedField is a profile value along with the sources that reported it
+type MergedField struct {
+	Value   string
+	Sources []string
+}
+
+// SocialHandle is a handle on a social platform along with the sources that reported it
+type SocialHandle struct {
+	Platform string
+	Handle   string
+	URL      string
+	Sources  []string
+}
+
+// MergedProfile is the best known profile of an address across all identity sources
+type MergedProfile struct {
+	DisplayName MergedField
+	Bio         MergedField
+	Avatar      MergedField
+	Ens         MergedField
+	Websites    []MergedField
+	Socials     []SocialHandle
+}
+
+// MergeOptions controls how NewMergedProfile picks between conflicting values
+type MergeOptions struct {
+	// SourcePriority ranks data sources from most to least trusted, unlisted sources rank last.
+	// DefaultSourcePriority is used when empty.
+	SourcePriority []string
+}
+
+type profileCandidate struct {
+	value  string
+	source string
+}
+
+type profileCandidates struct {
+	displayName []profileCandidate
+	bio         []profileCandidate
+	avatar      []profileCandidate
+	ens         []profileCandidate
+	websites    []profileCandidate
+	socials     map[string][]profileCandidate
+	platforms   []string
+}
+
+func (c *profileCandidates) addSocial(platform, handle, source string) {
+	if strings.TrimSpace(handle) == "" {
+		return
+	}
+	// Links and handles of the same account must compare equal
+	if link, err := NormalizeSocialLink(platform, handle); err == nil {
+		handle = link.Handle
+	}
+	if c.socials == nil {
+		c.socials = make(map[string][]profileCandidate)
+	}
+	if _, ok := c.socials[platform]; !ok {
+		c.platforms = append(c.platforms, platform)
+	}
+	c.socials[platform] = append(c.socials[platform], profileCandidate{value: handle, source: source})
+}
+
+// NewMergedProfile merges the per-platform records of ids into one profile. Single valued fields
+// take the value of the most trusted source, Websites and Socials keep every distinct value.
+func NewMergedProfile(ids IdentityEntryList, options MergeOptions) MergedProfile {
+	priority := options.SourcePriority
+	if len(priority) == 0 {
+		priority = DefaultSourcePriority
+	}
+	rank := func(source string) int {
+		for i, name := range priority {
+			if name == source {
+				return i
+			}
+		}
+		return len(priority)
+	}
+
+	c := collectProfileCandidates(ids)
+	profile := MergedProfile{
+		DisplayName: pickMergedField(c.displayName, rank),
+		Bio:         pickMergedField(c.bio, rank),
+		Avatar:      pickMergedField(c.avatar, rank),
+		Ens:         pickMergedField(c.ens, rank),
+		Websites:    groupMergedFields(c.websites, rank),
+	}
+	for _, platform := range c.platforms {
+		for _, field := range groupMergedFields(c.socials[platform], rank) {
+			social := SocialHandle{
+				Platform: platform,
+				Handle:   field.Value,
+				Sources:  field.Sources,
+			}
+			if link, err := NormalizeSocialLink(platform, field.Value); err == nil {
+				social.URL = link.URL
+			}
+			profile.Socials = append(profile.Socials, social)
+		}
+	}
+	return profile
+}
+
+func collectProfileCandidates(ids IdentityEntryList) profileCandidates {
+	var c profileCandidates
+	add := func(list *[]profileCandidate, value, source string) {
+		if strings.TrimSpace(value) != "" {
+			*list = append(*list, profileCandidate{value: value, source: source})
+		}
+	}
+
+	for _, id := range ids.Superrare {
+		add(&c.displayName, id.Username, id.DataSource)
+		add(&c.bio, id.Bio, id.DataSource)
+		add(&c.websites, id.Website, id.DataSource)
+		c.addSocial(TWITTER, id.TwitterLink, id.DataSource)
+		c.addSocial(INSTAGRAM, id.InstagramLink, id.DataSource)
+		c.addSocial(STEEMIT, id.SteemitLink, id.DataSource)
+		c.addSocial(SPOTIFY, id.SpotifyLink, id.DataSource)
+		c.addSocial(SOUNDCLOUD, id.SoundCloudLink, id.DataSource)
+	}
+	for _, id := range ids.Foundation {
+		add(&c.displayName, id.Username, id.DataSource)
+		add(&c.bio, id.Bio, id.DataSource)
+		add(&c.websites, id.Website, id.DataSource)
+		c.addSocial(TWITTER, id.Twitter, id.DataSource)
+		c.addSocial(INSTAGRAM, id.Instagram, id.DataSource)
+		c.addSocial(TIKTOK, id.Tiktok, id.DataSource)
+		c.addSocial(TWITCH, id.Twitch, id.DataSource)
+		c.addSocial(DISCORD, id.Discord, id.DataSource)
+		c.addSocial(YOUTUBE, id.Youtube, id.DataSource)
+		c.addSocial(FACEBOOK, id.Facebook, id.DataSource)
+		c.addSocial(SNAPCHAT, id.Snapchat, id.DataSource)
+	}
+	for _, id := range ids.Zora {
+		add(&c.displayName, id.Username, id.DataSource)
+		add(&c.bio, id.Bio, id.DataSource)
+		add(&c.websites, id.Website, id.DataSource)
+	}
+	for _, id := range ids.OpenSea {
+		add(&c.displayName, id.Username, id.DataSource)
+		add(&c.bio, id.Bio, id.DataSource)
+		add(&c.avatar, id.ProfileImage, id.DataSource)
+	}
+	for _, id := range ids.Rarible {
+		add(&c.displayName, id.Username, id.DataSource)
+	}
+	for _, id := range ids.Showtime {
+		add(&c.displayName, id.Name, id.DataSource)
+		add(&c.displayName, id.Username, id.DataSource)
+		add(&c.bio, id.Bio, id.DataSource)
+		c.addSocial(TWITTER, id.TwitterHandle, id.DataSource)
+		c.addSocial(LINKTREE, id.LinkTreeHandle, id.DataSource)
+		c.addSocial(CRYPTOART, id.CryptoArtHandle, id.DataSource)
+		c.addSocial(FOUNDATION, id.FoundationHandle, id.DataSource)
+		c.addSocial(HICETNUNC, id.HicetnuncHandle, id.DataSource)
+		c.addSocial(OPENSEA, id.OpenseaHandle, id.DataSource)
+		c.addSocial(RARIBLE, id.RaribleHandle, id.DataSource)
+	}
+	for _, id := range ids.Context {
+		add(&c.displayName, id.Username, id.DataSource)
+		add(&c.websites, id.Website, id.DataSource)
+	}
+	for _, id := range ids.EnsRecords {
+		add(&c.ens, id.Ens, id.DataSource)
+		add(&c.bio, id.Description, id.DataSource)
+		add(&c.avatar, id.Avatar, id.DataSource)
+		add(&c.websites, id.Url, id.DataSource)
+		c.addSocial(TWITTER, id.Twitter, id.DataSource)
+		c.addSocial(GITHUB, id.Github, id.DataSource)
+	}
+	for _, id := range ids.Twitter {
+		c.addSocial(TWITTER, id.Handle, id.DataSource)
+	}
+	return c
+}
+
+// groupMergedFields groups candidates by value, case-insensitively, in the order of the most
+// trusted source reporting each value
+func groupMergedFields(candidates []profileCandidate, rank func(string) int) []MergedField {
+	type rankedField struct {
+		field MergedField
+		rank  int
+	}
+	var ranked []rankedField
+	index := make(map[string]int)
+	for _, candidate := range candidates {
+		value := strings.TrimSpace(candidate.value)
+		key := strings.ToLower(value)
+		i, ok := index[key]
+		if !ok {
+			i = len(ranked)
+			index[key] = i
+			ranked = append(ranked, rankedField{field: MergedField{Value: value}, rank: rank(candidate.source)})
+		}
+		if !containsString(ranked[i].field.Sources, candidate.source) {
+			ranked[i].field.Sources = append(ranked[i].field.Sources, candidate.source)
+		}
+		if r := rank(candidate.source); r < ranked[i].rank {
+			// Keep the spelling of the most trusted source
+			ranked[i].field.Value, ranked[i].rank = value, r
+		}
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].rank < ranked[j].rank
+	})
+	var fields []MergedField
+	for _, r := range ranked {
+		fields = append(fields, r.field)
+	}
+	return fields
+}
+
+// pickMergedField returns the value of the most trusted source, zero if there is none
+func pickMergedField(candidates []profileCandidate, rank func(string) int) MergedField {
+	fields := groupMergedFields(candidates, rank)
+	if len(fields) == 0 {
+		return MergedField{}
+	}
+	return fields[0]
+}
@@ -0,0 +1,99 @@
+package fetcher
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testProfileIds is Brantly's identity as several sources report it
+var testProfileIds = IdentityEntryList{
+	Superrare: []UserSuperrareIdentity{
+		// Context.app's copy of the Superrare profile comes first
+		{Username: "Brantly", Bio: "copied bio", DataSource: CONTEXT},
+		{Username: "brantly", Bio: "ens", TwitterLink: "https://twitter.com/BrantlyMillegan", DataSource: SUPERRARE},
+	},
+	Zora:    []UserZoraIdentity{{Website: "https://Brantly.xyz", DataSource: ZORA}},
+	Context: []UserContextIdentity{{Username: "brantly-context", Website: "brantly.xyz/", DataSource: CONTEXT}},
+	EnsRecords: []UserEnsIdentity{
+		{Ens: "brantly.eth", Url: "https://brantly.xyz", Twitter: "@brantlymillegan", Github: "brantly", DataSource: ENS},
+	},
+	Twitter: []UserTwitterIdentity{{Handle: "brantlymillegan", Verified: true, DataSource: SYBIL}},
+}
+
+func TestNewMergedProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		priority []string
+		// field picks the part of the profile compared to want
+		field func(MergedProfile) interface{}
+		want  interface{}
+	}{
+		{
+			name:  "first-party before aggregator",
+			field: func(p MergedProfile) interface{} { return p.DisplayName },
+			// Both spell the same name, Superrare's spelling wins and both are credited
+			want: MergedField{Value: "brantly", Sources: []string{CONTEXT, SUPERRARE}},
+		},
+		{
+			name:  "default priority bio",
+			field: func(p MergedProfile) interface{} { return p.Bio },
+			want:  MergedField{Value: "ens", Sources: []string{SUPERRARE}},
+		},
+		{
+			name:     "custom priority",
+			priority: []string{CONTEXT, SUPERRARE},
+			field:    func(p MergedProfile) interface{} { return p.Bio },
+			want:     MergedField{Value: "copied bio", Sources: []string{CONTEXT}},
+		},
+		{
+			name:     "unlisted sources rank last",
+			priority: []string{ENS},
+			field:    func(p MergedProfile) interface{} { return p.Bio },
+			want:     MergedField{Value: "copied bio", Sources: []string{CONTEXT}},
+		},
+		{
+			name:  "ens",
+			field: func(p MergedProfile) interface{} { return p.Ens },
+			want:  MergedField{Value: "brantly.eth", Sources: []string{ENS}},
+		},
+		{
+			name:  "websites deduplicated case-insensitively",
+			field: func(p MergedProfile) interface{} { return p.Websites },
+			want: []MergedField{
+				{Value: "https://Brantly.xyz", Sources: []string{ZORA, ENS}},
+				{Value: "brantly.xyz/", Sources: []string{CONTEXT}},
+			},
+		},
+		{
+			name:  "handles deduplicated case-insensitively",
+			field: func(p MergedProfile) interface{} { return p.Socials },
+			want: []SocialHandle{
+				{Platform: TWITTER, Handle: "BrantlyMillegan", URL: "https://twitter.com/BrantlyMillegan", Sources: []string{SUPERRARE, ENS, SYBIL}},
+				{Platform: GITHUB, Handle: "brantly", URL: "https://github.com/brantly", Sources: []string{ENS}},
+			},
+		},
+		{
+			name:     "handle spelling of the most trusted source",
+			priority: []string{SYBIL},
+			field:    func(p MergedProfile) interface{} { return p.Socials[0].Handle },
+			want:     "brantlymillegan",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			profile := NewMergedProfile(testProfileIds, MergeOptions{SourcePriority: test.priority})
+			if got := test.field(profile); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewMergedProfileEmpty(t *testing.T) {
+	profile := NewMergedProfile(IdentityEntryList{
+		Superrare: []UserSuperrareIdentity{{Username: "  ", DataSource: SUPERRARE}},
+	}, MergeOptions{})
+	if !reflect.DeepEqual(profile, MergedProfile{}) {
+		t.Errorf("profile = %+v", profile)
+	}
+}
@@ -0,0 +1,158 @@
+package fetcher
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Confidence ranks how much an identity attribute can be trusted
+type Confidence int
+
+const (
+	ConfidenceUnknown Confidence = iota
+	// ConfidenceAggregator is data copied by a third party, e.g. Context.app
+	ConfidenceAggregator
+	// ConfidenceFirstParty is data from the platform's own API
+	ConfidenceFirstParty
+	// ConfidenceVerified is data proven by the address owner, on-chain or by a signed claim
+	ConfidenceVerified
+)
+
+func (c Confidence) String() string {
+	switch c {
+	case ConfidenceAggregator:
+		return "aggregator"
+	case ConfidenceFirstParty:
+		return "first-party"
+	case ConfidenceVerified:
+		return "verified"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText writes c as its name, so that JSON output reads "verified" rather than 3
+func (c Confidence) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *Confidence) UnmarshalText(text []byte) error {
+	for _, confidence := range []Confidence{ConfidenceUnknown, ConfidenceAggregator, ConfidenceFirstParty, ConfidenceVerified} {
+		if confidence.String() == string(text) {
+			*c = confidence
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown confidence %q", text)
+}
+
+// SourceConfidence is the confidence of the data each built-in source reports
+var SourceConfidence = map[string]Confidence{
+	CONTEXT:    ConfidenceAggregator,
+	SHOWTIME:   ConfidenceAggregator,
+	SUPERRARE:  ConfidenceFirstParty,
+	OPENSEA:    ConfidenceFirstParty,
+	FOUNDATION: ConfidenceFirstParty,
+	ZORA:       ConfidenceFirstParty,
+	RARIBLE:    ConfidenceFirstParty,
+	ENS:        ConfidenceVerified,
+	SYBIL:      ConfidenceVerified,
+}
+
+// IdentityAttribute is a single field of an identity record along with its provenance
+type IdentityAttribute struct {
+	// Platform is the identity record the field belongs to, e.g. SUPERRARE
+	Platform   string
+	Field      string
+	Value      string
+	Source     string
+	FetchedAt  time.Time
+	Confidence Confidence
+}
+
+// FieldConflict lists the attributes of sources that disagree on the same field
+type FieldConflict struct {
+	Platform string
+	Field    string
+	Values   []IdentityAttribute
+}
+
+// entryPlatforms maps the record fields of IdentityEntry to their platform
+var entryPlatforms = map[string]string{
+	"OpenSea":    OPENSEA,
+	"Twitter":    TWITTER,
+	"Superrare":  SUPERRARE,
+	"Rarible":    RARIBLE,
+	"Context":    CONTEXT,
+	"Zora":       ZORA,
+	"Ens":        ENS,
+	"Foundation": FOUNDATION,
+	"Showtime":   SHOWTIME,
+}
+
+// entryAttributes flattens the records of entry into attributes, skipping empty fields
+func entryAttributes(entry IdentityEntry, fetchedAt time.Time) []IdentityAttribute {
+	var attributes []IdentityAttribute
+	v := reflect.ValueOf(entry)
+	for i := 0; i < v.NumField(); i++ {
+		platform, ok := entryPlatforms[v.Type().Field(i).Name]
+		if !ok || v.Field(i).IsNil() {
+			continue
+		}
+		record := v.Field(i).Elem()
+		source := record.FieldByName("DataSource").String()
+		for j := 0; j < record.NumField(); j++ {
+			field := record.Type().Field(j)
+			if field.Name == "DataSource" || record.Field(j).IsZero() {
+				continue
+			}
+			confidence := SourceConfidence[source]
+			// A field X is verified by the platform when the record sets XVerified, e.g. TwitterVerified
+			if verified := record.FieldByName(field.Name + "Verified"); verified.Kind() == reflect.Bool && verified.Bool() {
+				confidence = ConfidenceVerified
+			}
+			attributes = append(attributes, IdentityAttribute{
+				Platform:   platform,
+				Field:      field.Name,
+				Value:      fmt.Sprint(record.Field(j).Interface()),
+				Source:     source,
+				FetchedAt:  fetchedAt,
+				Confidence: confidence,
+			})
+		}
+	}
+	return attributes
+}
+
+// findConflicts returns the fields for which sources reported different values
+func findConflicts(attributes []IdentityAttribute) []FieldConflict {
+	var conflicts []FieldConflict
+	index := make(map[[2]string]int)
+	var groups [][]IdentityAttribute
+	for _, attribute := range attributes {
+		key := [2]string{attribute.Platform, attribute.Field}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], attribute)
+	}
+
+	for _, group := range groups {
+		for _, attribute := range group[1:] {
+			if !strings.EqualFold(strings.TrimSpace(attribute.Value), strings.TrimSpace(group[0].Value)) {
+				conflicts = append(conflicts, FieldConflict{
+					Platform: group[0].Platform,
+					Field:    group[0].Field,
+					Values:   group,
+				})
+				break
+			}
+		}
+	}
+	return conflicts
+}
@@ -0,0 +1,57 @@
+package fetcher
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestEntryAttributesConfidence(t *testing.T) {
+	entry := IdentityEntry{
+		Foundation: &UserFoundationIdentity{
+			Username:        "brantly",
+			Twitter:         "brantlymillegan",
+			TwitterVerified: true,
+			Instagram:       "brantly.eth",
+			DataSource:      FOUNDATION,
+		},
+		Zora: &UserZoraIdentity{Username: "brantly", DataSource: CONTEXT},
+	}
+	want := map[string]Confidence{
+		"Foundation.Username":        ConfidenceFirstParty,
+		"Foundation.Twitter":         ConfidenceVerified,
+		"Foundation.TwitterVerified": ConfidenceFirstParty,
+		"Foundation.Instagram":       ConfidenceFirstParty,
+		"Zora.Username":              ConfidenceAggregator,
+	}
+
+	attributes := entryAttributes(entry, time.Now())
+	if len(attributes) != len(want) {
+		t.Fatalf("attributes = %+v", attributes)
+	}
+	for _, attribute := range attributes {
+		if key := attribute.Platform + "." + attribute.Field; attribute.Confidence != want[key] {
+			t.Errorf("%s: confidence %s, want %s", key, attribute.Confidence, want[key])
+		}
+	}
+}
+
+func TestConfidenceJSON(t *testing.T) {
+	b, err := json.Marshal(IdentityAttribute{Confidence: ConfidenceVerified})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var attribute struct{ Confidence string }
+	json.Unmarshal(b, &attribute)
+	if attribute.Confidence != "verified" {
+		t.Errorf("confidence = %q", attribute.Confidence)
+	}
+
+	var decoded IdentityAttribute
+	if err := json.Unmarshal(b, &decoded); err != nil || decoded.Confidence != ConfidenceVerified {
+		t.Errorf("decoded %+v, %v", decoded, err)
+	}
+	if err := json.Unmarshal([]byte(`{"Confidence": "certain"}`), &decoded); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,219 @@
+package fetcher
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HostLimit throttles the requests sent to one upstream host, requests over the limit wait
+// in line instead of failing
+type HostLimit struct {
+	// Rate is the sustained number of requests per second, 0 means unlimited
+	Rate float64
+	// Burst is the number of requests that may be sent at once on top of Rate, at least 1
+	Burst int
+	// MaxConcurrent caps the requests in flight, 0 means unlimited
+	MaxConcurrent int
+}
+
+// HostMetrics reports the traffic a fetcher sent to one rate limited host
+type HostMetrics struct {
+	Requests  int64
+	InFlight  int64
+	QueueWait time.Duration
+}
+
+// WithHostLimits throttles the requests to the given hosts, keyed by host name,
+// e.g. {"api-mainnet.rarible.com": {Rate: 5, Burst: 10, MaxConcurrent: 4}}
+func WithHostLimits(limits map[string]HostLimit) Option {
+	return func(f *fetcher) {
+		if f.hostLimits == nil {
+			f.hostLimits = make(map[string]HostLimit)
+		}
+		for host, limit := range limits {
+			f.hostLimits[host] = limit
+		}
+	}
+}
+
+// HostMetrics returns the traffic sent to every rate limited host so far
+func (f *fetcher) HostMetrics() map[string]HostMetrics {
+	metrics := make(map[string]HostMetrics)
+	transport, ok := f.httpClient.Transport.(*limitedTransport)
+	if !ok {
+		return metrics
+	}
+	for host, limiter := range transport.limiters {
+		metrics[host] = limiter.metrics()
+	}
+	return metrics
+}
+
+// limitedTransport queues requests to rate limited hosts before handing them to base
+type limitedTransport struct {
+	base     http.RoundTripper
+	limiters map[string]*hostLimiter
+}
+
+func newLimitedTransport(base http.RoundTripper, limits map[string]HostLimit) *limitedTransport {
+	t := &limitedTransport{
+		base:     base,
+		limiters: make(map[string]*hostLimiter),
+	}
+	for host, limit := range limits {
+		t.limiters[host] = newHostLimiter(limit)
+	}
+	return t
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	limiter, ok := t.limiters[req.URL.Hostname()]
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+
+	start := time.Now()
+	err := limiter.acquire(req)
+	wait := time.Since(start)
+	limiter.recordWait(wait)
+	traceFromContext(req.Context()).recordQueueWait(wait)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		limiter.release()
+		return nil, err
+	}
+	// The request stays in flight until its body is consumed
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: limiter.release}
+	return resp, nil
+}
+
+type hostLimiter struct {
+	bucket *tokenBucket
+	slots  chan struct{}
+
+	mu       sync.Mutex
+	requests int64
+	inFlight int64
+	wait     time.Duration
+}
+
+func newHostLimiter(limit HostLimit) *hostLimiter {
+	l := &hostLimiter{}
+	if limit.Rate > 0 {
+		l.bucket = newTokenBucket(limit.Rate, limit.Burst)
+	}
+	if limit.MaxConcurrent > 0 {
+		l.slots = make(chan struct{}, limit.MaxConcurrent)
+	}
+	return l
+}
+
+// acquire waits for a concurrency slot and a rate token, or for the request context to be done
+func (l *hostLimiter) acquire(req *http.Request) error {
+	ctx := req.Context()
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if l.bucket != nil {
+		if delay := l.bucket.reserve(); delay > 0 {
+			if err := sleepContext(ctx, delay); err != nil {
+				l.bucket.cancel()
+				if l.slots != nil {
+					<-l.slots
+				}
+				return err
+			}
+		}
+	}
+
+	l.mu.Lock()
+	l.requests++
+	l.inFlight++
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *hostLimiter) release() {
+	l.mu.Lock()
+	l.inFlight--
+	l.mu.Unlock()
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+func (l *hostLimiter) recordWait(wait time.Duration) {
+	l.mu.Lock()
+	l.wait += wait
+	l.mu.Unlock()
+}
+
+func (l *hostLimiter) metrics() HostMetrics {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return HostMetrics{Requests: l.requests, InFlight: l.inFlight, QueueWait: l.wait}
+}
+
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
+
+// tokenBucket hands out rate tokens, a reservation may drive the bucket negative so that
+// waiters are served in order
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// reserve takes a token and returns how long to wait before it may be used
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel gives back a reserved token that was not used
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	b.tokens++
+	b.mu.Unlock()
+}
@@ -0,0 +1,200 @@
+package fetcher
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newLimitedClient returns a client throttled by limit towards httptest servers
+func newLimitedClient(limit HostLimit) (*http.Client, *hostLimiter) {
+	transport := newLimitedTransport(http.DefaultTransport, map[string]HostLimit{"127.0.0.1": limit})
+	return &http.Client{Transport: transport}, transport.limiters["127.0.0.1"]
+}
+
+func sendGet(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+func TestHostLimitMaxConcurrent(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+	}))
+	defer server.Close()
+	client, limiter := newLimitedClient(HostLimit{MaxConcurrent: 2})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := sendGet(context.Background(), client, server.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight != 2 {
+		t.Errorf("%d requests in flight at once, want 2", maxInFlight)
+	}
+	if metrics := limiter.metrics(); metrics.Requests != 8 || metrics.InFlight != 0 {
+		t.Errorf("metrics = %+v", metrics)
+	}
+}
+
+func TestHostLimitRate(t *testing.T) {
+	var mu sync.Mutex
+	var arrivals []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		arrivals = append(arrivals, time.Now())
+		mu.Unlock()
+	}))
+	defer server.Close()
+	const interval = 50 * time.Millisecond
+	client, _ := newLimitedClient(HostLimit{Rate: float64(time.Second / interval), Burst: 1})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := sendGet(context.Background(), client, server.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(arrivals, func(i, j int) bool { return arrivals[i].Before(arrivals[j]) })
+	// Allow for the scheduling of the server goroutines
+	for i := 1; i < len(arrivals); i++ {
+		if gap := arrivals[i].Sub(arrivals[i-1]); gap < interval*7/10 {
+			t.Errorf("request %d sent %v after the previous one, want about %v", i, gap, interval)
+		}
+	}
+}
+
+func TestHostLimitCancelled(t *testing.T) {
+	limiter := newHostLimiter(HostLimit{Rate: 1, Burst: 1, MaxConcurrent: 1})
+	req := httptest.NewRequest("GET", "http://127.0.0.1/", nil)
+	if err := limiter.acquire(req); err != nil {
+		t.Fatal(err)
+	}
+
+	// Waiting for the slot
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.acquire(req.WithContext(ctx)); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v", err)
+	}
+	limiter.release()
+	if len(limiter.slots) != 0 {
+		t.Errorf("%d slots taken after release", len(limiter.slots))
+	}
+
+	// Waiting for a token, the bucket is empty for about a second
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.acquire(req.WithContext(ctx)); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v", err)
+	}
+	if len(limiter.slots) != 0 {
+		t.Errorf("cancelled request kept its slot")
+	}
+	limiter.bucket.mu.Lock()
+	tokens := limiter.bucket.tokens
+	limiter.bucket.mu.Unlock()
+	if tokens < -0.5 {
+		t.Errorf("cancelled request kept its token, %v tokens left", tokens)
+	}
+	if metrics := limiter.metrics(); metrics.Requests != 1 || metrics.InFlight != 0 {
+		t.Errorf("metrics = %+v", metrics)
+	}
+}
+
+func TestHostLimitReleaseOnClose(t *testing.T) {
+	server := httptest.NewServer(respond(http.StatusOK, "body"))
+	defer server.Close()
+	client, limiter := newLimitedClient(HostLimit{MaxConcurrent: 1})
+
+	resp, err := sendGet(context.Background(), client, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(resp.Body)
+	if metrics := limiter.metrics(); metrics.InFlight != 1 {
+		t.Errorf("in flight before close = %d, want 1", metrics.InFlight)
+	}
+	// The slot is still taken, the next request waits until it gives up
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := sendGet(ctx, client, server.URL); err == nil {
+		t.Error("request sent while the slot was taken")
+	}
+
+	resp.Body.Close()
+	resp.Body.Close()
+	if metrics := limiter.metrics(); metrics.InFlight != 0 {
+		t.Errorf("in flight after close = %d, want 0", metrics.InFlight)
+	}
+	resp, err = sendGet(context.Background(), client, server.URL)
+	if err != nil {
+		t.Fatalf("request after close: %v", err)
+	}
+	resp.Body.Close()
+	if len(limiter.slots) != 0 {
+		t.Errorf("%d slots taken", len(limiter.slots))
+	}
+}
+
+func TestHostLimitQueueWait(t *testing.T) {
+	f := newTestFetcher(t, respond(http.StatusOK, `{}`),
+		WithSources(CONTEXT, SUPERRARE),
+		WithHostLimits(map[string]HostLimit{"127.0.0.1": {Rate: 10, Burst: 1}}),
+	)
+
+	ids, err := f.FetchIdentity(testAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One of the two sources waits a tenth of a second for the second token
+	var wait time.Duration
+	for _, status := range ids.Sources {
+		wait += status.QueueWait
+	}
+	if wait < 50*time.Millisecond {
+		t.Errorf("sources waited %v", wait)
+	}
+	metrics := f.HostMetrics()["127.0.0.1"]
+	if metrics.Requests != 2 || metrics.QueueWait < wait {
+		t.Errorf("metrics = %+v, sources waited %v", metrics, wait)
+	}
+}
@@ -0,0 +1,111 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how sendRequest retries 429 and 5xx responses and network errors
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt, 0 disables retrying
+	MaxRetries int
+	// BaseDelay is the backoff before the first retry, it doubles on every further retry
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff and the Retry-After waited for, a response asking for a longer
+	// wait fails without retrying. With 0 the backoff is not capped and DefaultRetryPolicy.MaxDelay
+	// caps Retry-After.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used for sources without a policy of their own
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 2,
+	BaseDelay:  500 * time.Millisecond,
+	MaxDelay:   10 * time.Second,
+}
+
+// WithRetryPolicy sets the retry policy of the named source, e.g. WithRetryPolicy(RARIBLE, policy)
+func WithRetryPolicy(source string, policy RetryPolicy) Option {
+	return func(f *fetcher) {
+		if f.retryPolicies == nil {
+			f.retryPolicies = make(map[string]RetryPolicy)
+		}
+		f.retryPolicies[source] = policy
+	}
+}
+
+func (f *fetcher) retryPolicy(source string) RetryPolicy {
+	if policy, ok := f.retryPolicies[source]; ok {
+		return policy
+	}
+	return DefaultRetryPolicy
+}
+
+// backoff returns the jittered delay before retry number attempt, counting from 0
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << uint(attempt)
+	if delay <= 0 || (p.MaxDelay > 0 && delay > p.MaxDelay) {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	// Equal jitter keeps at least half of the delay while spreading concurrent clients apart
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// maxRetryAfter is the longest Retry-After worth waiting for
+func (p RetryPolicy) maxRetryAfter() time.Duration {
+	if p.MaxDelay > 0 {
+		return p.MaxDelay
+	}
+	return DefaultRetryPolicy.MaxDelay
+}
+
+// isRetryable reports whether the failed request may succeed when sent again
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= 500
+	}
+	// Transport errors of http.Client.Do
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// parseRetryAfter reads the Retry-After header, given either in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// sleepContext waits for d, returning early with ctx.Err() when ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
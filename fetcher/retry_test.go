@@ -0,0 +1,131 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"", 0, 0},
+		{"0", 0, 0},
+		{"-5", 0, 0},
+		{"soon", 0, 0},
+		{"120", 2 * time.Minute, 2 * time.Minute},
+		{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute},
+		{time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0},
+	}
+	for _, test := range tests {
+		if got := parseRetryAfter(test.value); got < test.min || got > test.max {
+			t.Errorf("parseRetryAfter(%q) = %v, want between %v and %v", test.value, got, test.min, test.max)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"429", context.Background(), &HTTPError{StatusCode: http.StatusTooManyRequests}, true},
+		{"500", context.Background(), &HTTPError{StatusCode: http.StatusInternalServerError}, true},
+		{"503", context.Background(), &HTTPError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"400", context.Background(), &HTTPError{StatusCode: http.StatusBadRequest}, false},
+		{"404", context.Background(), &HTTPError{StatusCode: http.StatusNotFound}, false},
+		{"network", context.Background(), &url.Error{Op: "Get", URL: "http://x", Err: errors.New("connection reset")}, true},
+		{"other", context.Background(), errors.New("json: bad"), false},
+		{"cancelled", cancelled, &HTTPError{StatusCode: http.StatusServiceUnavailable}, false},
+	}
+	for _, test := range tests {
+		if got := isRetryable(test.ctx, test.err); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+	for attempt, full := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond} {
+		for i := 0; i < 20; i++ {
+			if delay := policy.backoff(attempt); delay < full/2 || delay > full {
+				t.Errorf("attempt %d: delay %v outside [%v, %v]", attempt, delay, full/2, full)
+			}
+		}
+	}
+	if delay := (RetryPolicy{}).backoff(3); delay != 0 {
+		t.Errorf("zero policy delay %v", delay)
+	}
+}
+
+// unavailableHandler answers 503 with retryAfter for the first failures requests, then 200
+func unavailableHandler(failures int32, retryAfter string, requests *int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(requests, 1) <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`ok`))
+	})
+}
+
+func TestSendRequestRetries(t *testing.T) {
+	var requests int32
+	f := newTestFetcher(t, unavailableHandler(1, "", &requests))
+	ctx, trace := withSourceTrace(context.Background(), RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond})
+
+	body, err := sendRequest(ctx, f.httpClient, RequestArgs{url: f.sourceURL(ZORA, ZoraUrl, testAddress), method: "GET"})
+	if err != nil || string(body) != "ok" {
+		t.Fatalf("got %q, %v", body, err)
+	}
+	if requests != 2 || trace.retries != 1 || trace.statusCode != http.StatusOK {
+		t.Errorf("requests %d, retries %d, status %d", requests, trace.retries, trace.statusCode)
+	}
+}
+
+func TestSendRequestGivesUp(t *testing.T) {
+	var requests int32
+	f := newTestFetcher(t, unavailableHandler(10, "", &requests))
+	ctx, trace := withSourceTrace(context.Background(), RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond})
+
+	_, err := sendRequest(ctx, f.httpClient, RequestArgs{url: f.sourceURL(ZORA, ZoraUrl, testAddress), method: "GET"})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("err = %v", err)
+	}
+	if requests != 3 || trace.retries != 2 {
+		t.Errorf("requests %d, retries %d", requests, trace.retries)
+	}
+}
+
+func TestSendRequestLongRetryAfter(t *testing.T) {
+	var requests int32
+	f := newTestFetcher(t, unavailableHandler(1, "86400", &requests))
+	ctx, trace := withSourceTrace(context.Background(), RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Second})
+
+	start := time.Now()
+	_, err := sendRequest(ctx, f.httpClient, RequestArgs{url: f.sourceURL(ZORA, ZoraUrl, testAddress), method: "GET"})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.RetryAfter != 24*time.Hour {
+		t.Fatalf("err = %v", err)
+	}
+	if time.Since(start) > time.Second || requests != 1 || trace.retries != 0 {
+		t.Errorf("waited %v, requests %d, retries %d", time.Since(start), requests, trace.retries)
+	}
+}
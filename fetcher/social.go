@@ -0,0 +1,261 @@
+package fetcher
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// SocialLink is the canonical form of a handle on a social platform
+type SocialLink struct {
+	Platform string
+	Handle   string
+	// URL is the profile page of the handle, empty if the platform has none, e.g. Discord
+	URL string
+}
+
+// InvalidHandleError is returned by NormalizeSocialLink when the input is no valid handle or
+// profile link of the platform
+type InvalidHandleError struct {
+	Platform string
+	Input    string
+	Reason   string
+}
+
+func (e *InvalidHandleError) Error() string {
+	return fmt.Sprintf("invalid %s handle %q: %s", e.Platform, e.Input, e.Reason)
+}
+
+type socialPlatform struct {
+	// hosts are the domains of profile links, without "www."
+	hosts []string
+	// prefix is stripped from the link path before the handle, e.g. "@" for TikTok
+	prefix string
+	// segments is the number of path segments the handle spans
+	segments int
+	// profile formats the profile URL of a handle, empty if the platform has none
+	profile string
+	handle  *regexp.Regexp
+	// reserved are lowercase first path segments of links that are not profiles, e.g. "intent"
+	reserved []string
+}
+
+var socialPlatforms = map[string]socialPlatform{
+	TWITTER: {
+		hosts:    []string{"twitter.com", "mobile.twitter.com", "twitter"},
+		segments: 1,
+		profile:  "https://twitter.com/%s",
+		handle:   regexp.MustCompile(`^[A-Za-z0-9_]{1,15}$`),
+		reserved: []string{"i", "intent", "home", "search", "hashtag", "share", "explore", "settings", "messages", "notifications", "login", "signup"},
+	},
+	INSTAGRAM: {
+		hosts:    []string{"instagram.com", "instagr.am"},
+		segments: 1,
+		profile:  "https://www.instagram.com/%s",
+		handle:   regexp.MustCompile(`^[A-Za-z0-9._]{1,30}$`),
+		reserved: []string{"p", "reel", "reels", "tv", "explore", "stories", "accounts", "direct"},
+	},
+	TIKTOK: {
+		hosts:    []string{"tiktok.com", "vm.tiktok.com"},
+		prefix:   "@",
+		segments: 1,
+		profile:  "https://www.tiktok.com/@%s",
+		handle:   regexp.MustCompile(`^[A-Za-z0-9._]{2,24}$`),
+		reserved: []string{"tag", "music", "discover", "video", "t"},
+	},
+	TWITCH: {
+		hosts:    []string{"twitch.tv", "m.twitch.tv"},
+		segments: 1,
+		profile:  "https://www.twitch.tv/%s",
+		handle:   regexp.MustCompile(`^[A-Za-z0-9_]{3,25}$`),
+		reserved: []string{"directory", "videos", "search", "settings", "p"},
+	},
+	YOUTUBE: {
+		hosts:    []string{"youtube.com", "m.youtube.com"},
+		segments: 2,
+		profile:  "https://www.youtube.com/%s",
+		handle:   regexp.MustCompile(`^((c|user|channel)/|@)?[A-Za-z0-9._-]{1,100}$`),
+		reserved: []string{"watch", "results", "playlist", "feed", "shorts", "embed"},
+	},
+	SOUNDCLOUD: {
+		hosts:    []string{"soundcloud.com", "m.soundcloud.com"},
+		segments: 1,
+		profile:  "https://soundcloud.com/%s",
+		handle:   regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`),
+		reserved: []string{"search", "discover", "stream", "charts", "you"},
+	},
+	SPOTIFY: {
+		hosts:    []string{"open.spotify.com", "spotify.com"},
+		segments: 2,
+		profile:  "https://open.spotify.com/%s",
+		handle:   regexp.MustCompile(`^(artist|user)/[A-Za-z0-9._-]+$`),
+	},
+	STEEMIT: {
+		hosts:    []string{"steemit.com"},
+		prefix:   "@",
+		segments: 1,
+		profile:  "https://steemit.com/@%s",
+		handle:   regexp.MustCompile(`^[a-z0-9.-]{3,16}$`),
+		reserved: []string{"trending", "hot", "created"},
+	},
+	DISCORD: {
+		// Discord has no public profile page, only bare handles are accepted
+		segments: 1,
+		handle:   regexp.MustCompile(`^([^@#:/]{2,32}#[0-9]{4}|[a-z0-9_.]{2,32})$`),
+	},
+	FACEBOOK: {
+		hosts:    []string{"facebook.com", "m.facebook.com", "fb.com"},
+		segments: 1,
+		profile:  "https://www.facebook.com/%s",
+		handle:   regexp.MustCompile(`^[A-Za-z0-9.]{5,50}$`),
+		reserved: []string{"sharer", "share", "groups", "events", "watch", "photo.php", "profile.php", "permalink.php"},
+	},
+	SNAPCHAT: {
+		hosts:    []string{"snapchat.com"},
+		prefix:   "add/",
+		segments: 1,
+		profile:  "https://www.snapchat.com/add/%s",
+		handle:   regexp.MustCompile(`^[A-Za-z0-9._-]{3,15}$`),
+		reserved: []string{"discover", "spotlight", "lens"},
+	},
+	GITHUB: {
+		hosts:    []string{"github.com"},
+		segments: 1,
+		profile:  "https://github.com/%s",
+		handle:   regexp.MustCompile(`^[A-Za-z0-9-]{1,39}$`),
+		reserved: []string{"orgs", "settings", "marketplace", "explore", "topics", "sponsors", "features", "about", "login", "pricing"},
+	},
+	LINKTREE: {
+		hosts:    []string{"linktr.ee"},
+		segments: 1,
+		profile:  "https://linktr.ee/%s",
+		handle:   regexp.MustCompile(`^[A-Za-z0-9._]{1,30}$`),
+	},
+}
+
+// NormalizeSocialLink turns a profile link or handle of platform, e.g. "https://twitter.com/foo/",
+// "twitter.com/foo" or "@foo", into its canonical SocialLink
+func NormalizeSocialLink(platform, input string) (SocialLink, error) {
+	spec, ok := socialPlatforms[platform]
+	if !ok {
+		return SocialLink{}, &InvalidHandleError{Platform: platform, Input: input, Reason: "unsupported platform"}
+	}
+
+	handle := strings.TrimSpace(input)
+	if link, ok := parseSocialURL(spec, handle); ok {
+		if containsString(spec.reserved, strings.ToLower(strings.SplitN(link, "/", 2)[0])) {
+			return SocialLink{}, &InvalidHandleError{Platform: platform, Input: input, Reason: "not a profile link"}
+		}
+		handle = link
+	} else {
+		handle = strings.Trim(handle, "/")
+	}
+	// Some platforms write handles with a leading "@" that is not part of it
+	if !spec.handle.MatchString(handle) {
+		handle = strings.TrimPrefix(handle, "@")
+	}
+	if handle == "" {
+		return SocialLink{}, &InvalidHandleError{Platform: platform, Input: input, Reason: "empty handle"}
+	}
+	if !spec.handle.MatchString(handle) {
+		return SocialLink{}, &InvalidHandleError{Platform: platform, Input: input, Reason: "unexpected characters"}
+	}
+
+	link := SocialLink{Platform: platform, Handle: handle}
+	if spec.profile != "" {
+		link.URL = fmt.Sprintf(spec.profile, handle)
+	}
+	return link, nil
+}
+
+// parseSocialURL returns the handle part of input when it is a link to one of the platform hosts
+func parseSocialURL(spec socialPlatform, input string) (string, bool) {
+	raw := input
+	hasScheme := strings.Contains(raw, "://")
+	if !hasScheme {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	if !containsString(spec.hosts, host) {
+		return "", false
+	}
+	// A bare host like "twitter" is only a link with a scheme, otherwise it is a handle
+	if !hasScheme && !strings.Contains(host, ".") {
+		return "", false
+	}
+
+	// Drop trailing segments like "/status/123" or "/videos"
+	segments := strings.Split(strings.TrimPrefix(strings.Trim(u.Path, "/"), spec.prefix), "/")
+	for n := spec.segments; n > 1; n-- {
+		if len(segments) >= n {
+			if handle := strings.Join(segments[:n], "/"); spec.handle.MatchString(handle) {
+				return handle, true
+			}
+		}
+	}
+	return segments[0], true
+}
+
+// normalizeEntryLinks rewrites the social fields of entry into canonical form, "Link" fields get the
+// profile URL and handle fields the handle. Invalid values are logged and cleared.
+func normalizeEntryLinks(entry *IdentityEntry) {
+	handle := func(platform string, field *string) {
+		normalizeSocialField(platform, field, false)
+	}
+	link := func(platform string, field *string) {
+		normalizeSocialField(platform, field, true)
+	}
+
+	if entry.Twitter != nil {
+		handle(TWITTER, &entry.Twitter.Handle)
+	}
+	if entry.Superrare != nil {
+		link(INSTAGRAM, &entry.Superrare.InstagramLink)
+		link(TWITTER, &entry.Superrare.TwitterLink)
+		link(STEEMIT, &entry.Superrare.SteemitLink)
+		link(SPOTIFY, &entry.Superrare.SpotifyLink)
+		link(SOUNDCLOUD, &entry.Superrare.SoundCloudLink)
+	}
+	if entry.Foundation != nil {
+		handle(TIKTOK, &entry.Foundation.Tiktok)
+		handle(TWITCH, &entry.Foundation.Twitch)
+		handle(DISCORD, &entry.Foundation.Discord)
+		handle(TWITTER, &entry.Foundation.Twitter)
+		handle(YOUTUBE, &entry.Foundation.Youtube)
+		handle(FACEBOOK, &entry.Foundation.Facebook)
+		handle(SNAPCHAT, &entry.Foundation.Snapchat)
+		handle(INSTAGRAM, &entry.Foundation.Instagram)
+	}
+	if entry.Showtime != nil {
+		handle(TWITTER, &entry.Showtime.TwitterHandle)
+		handle(LINKTREE, &entry.Showtime.LinkTreeHandle)
+	}
+	if entry.Ens != nil {
+		handle(TWITTER, &entry.Ens.Twitter)
+		handle(GITHUB, &entry.Ens.Github)
+	}
+}
+
+func normalizeSocialField(platform string, field *string, asURL bool) {
+	if *field == "" {
+		return
+	}
+	link, err := NormalizeSocialLink(platform, *field)
+	if err != nil {
+		zap.L().With(zap.Error(err)).Error("unqualified social handle")
+		*field = ""
+		return
+	}
+	if asURL && link.URL != "" {
+		*field = link.URL
+	} else {
+		*field = link.Handle
+	}
+}
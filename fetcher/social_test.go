@@ -0,0 +1,98 @@
+package fetcher
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeSocialLink(t *testing.T) {
+	tests := []struct {
+		platform string
+		input    string
+		handle   string
+		url      string
+	}{
+		{TWITTER, "https://twitter.com/foo/", "foo", "https://twitter.com/foo"},
+		{TWITTER, "twitter.com/foo/status/123", "foo", "https://twitter.com/foo"},
+		{TWITTER, "@foo", "foo", "https://twitter.com/foo"},
+		{TWITTER, " foo ", "foo", "https://twitter.com/foo"},
+		{TWITTER, "twitter", "twitter", "https://twitter.com/twitter"},
+		{TWITTER, "Twitter", "Twitter", "https://twitter.com/Twitter"},
+		{TWITTER, "@twitter", "twitter", "https://twitter.com/twitter"},
+		{TWITTER, "https://twitter/foo", "foo", "https://twitter.com/foo"},
+		{INSTAGRAM, "https://www.instagram.com/foo.bar/", "foo.bar", "https://www.instagram.com/foo.bar"},
+		{INSTAGRAM, "@foo_bar", "foo_bar", "https://www.instagram.com/foo_bar"},
+		{TIKTOK, "https://www.tiktok.com/@foo.bar?lang=en", "foo.bar", "https://www.tiktok.com/@foo.bar"},
+		{TIKTOK, "@foo", "foo", "https://www.tiktok.com/@foo"},
+		{TWITCH, "https://www.twitch.tv/foo_bar/videos", "foo_bar", "https://www.twitch.tv/foo_bar"},
+		{YOUTUBE, "https://www.youtube.com/c/FooBar/videos", "c/FooBar", "https://www.youtube.com/c/FooBar"},
+		{YOUTUBE, "youtube.com/@foo", "@foo", "https://www.youtube.com/@foo"},
+		{SOUNDCLOUD, "https://soundcloud.com/foo-bar/tracks", "foo-bar", "https://soundcloud.com/foo-bar"},
+		{SPOTIFY, "https://open.spotify.com/artist/4Z8W4fKeB5YxbusRsdQVPb", "artist/4Z8W4fKeB5YxbusRsdQVPb", "https://open.spotify.com/artist/4Z8W4fKeB5YxbusRsdQVPb"},
+		{STEEMIT, "https://steemit.com/@foo-bar", "foo-bar", "https://steemit.com/@foo-bar"},
+		{DISCORD, "foo#1234", "foo#1234", ""},
+		{DISCORD, "foo.bar", "foo.bar", ""},
+		{FACEBOOK, "https://m.facebook.com/foo.bar", "foo.bar", "https://www.facebook.com/foo.bar"},
+		{SNAPCHAT, "https://www.snapchat.com/add/foo_bar", "foo_bar", "https://www.snapchat.com/add/foo_bar"},
+		{GITHUB, "https://github.com/foo-bar/repo", "foo-bar", "https://github.com/foo-bar"},
+		{LINKTREE, "linktr.ee/foo", "foo", "https://linktr.ee/foo"},
+	}
+	covered := make(map[string]bool)
+	for _, test := range tests {
+		covered[test.platform] = true
+		link, err := NormalizeSocialLink(test.platform, test.input)
+		if err != nil {
+			t.Errorf("%s %q: %v", test.platform, test.input, err)
+			continue
+		}
+		if link.Platform != test.platform || link.Handle != test.handle || link.URL != test.url {
+			t.Errorf("%s %q: got %+v, want handle %q url %q", test.platform, test.input, link, test.handle, test.url)
+		}
+	}
+	for platform := range socialPlatforms {
+		if !covered[platform] {
+			t.Errorf("no test for %s", platform)
+		}
+	}
+}
+
+func TestNormalizeSocialLinkInvalid(t *testing.T) {
+	tests := []struct {
+		platform string
+		input    string
+		reason   string
+	}{
+		// convertTwitterHandle used to panic on empty values
+		{TWITTER, "", "empty handle"},
+		{TWITTER, "   ", "empty handle"},
+		{TWITTER, "@", "empty handle"},
+		{TWITTER, "https://twitter.com/", "empty handle"},
+		{TWITTER, "https://twitter.com/intent/tweet?text=hi", "not a profile link"},
+		{TWITTER, "twitter.com/i/web/status/1", "not a profile link"},
+		{TWITTER, "far_too_long_for_twitter", "unexpected characters"},
+		{INSTAGRAM, "https://www.instagram.com/p/XYZ/", "not a profile link"},
+		{TIKTOK, "https://www.tiktok.com/tag/art", "not a profile link"},
+		{TWITCH, "https://www.twitch.tv/directory/game/Art", "not a profile link"},
+		{YOUTUBE, "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "not a profile link"},
+		{SOUNDCLOUD, "https://soundcloud.com/discover", "not a profile link"},
+		{SPOTIFY, "https://open.spotify.com/track/4uLU6hMCjMI75M1A2tKUQC", "unexpected characters"},
+		{STEEMIT, "https://steemit.com/trending", "not a profile link"},
+		{DISCORD, "https://discord.gg/invite", "unexpected characters"},
+		{FACEBOOK, "https://www.facebook.com/sharer/sharer.php?u=x", "not a profile link"},
+		{SNAPCHAT, "https://www.snapchat.com/discover/foo", "not a profile link"},
+		{GITHUB, "https://github.com/orgs/foo", "not a profile link"},
+		{LINKTREE, "linktr.ee/foo bar", "unexpected characters"},
+		{"Myspace", "foo", "unsupported platform"},
+	}
+	for _, test := range tests {
+		link, err := NormalizeSocialLink(test.platform, test.input)
+		var invalid *InvalidHandleError
+		if !errors.As(err, &invalid) {
+			t.Errorf("%s %q: got %+v, %v", test.platform, test.input, link, err)
+			continue
+		}
+		if invalid.Reason != test.reason {
+			t.Errorf("%s %q: reason %q, want %q", test.platform, test.input, invalid.Reason, test.reason)
+		}
+	}
+}
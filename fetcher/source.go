@@ -0,0 +1,112 @@
+package fetcher
+
+import (
+	"context"
+	"sort"
+)
+
+// IdentitySource is a data source that contributes identity data for an address
+type IdentitySource interface {
+	// Name returns the platform name of the source, e.g. CONTEXT
+	Name() string
+	// FetchIdentity returns the identity found for address, failures are reported
+	// through IdentityEntry.Err
+	FetchIdentity(ctx context.Context, address string) IdentityEntry
+}
+
+// ConnectionSource is a data source that contributes following / follower data for an address
+type ConnectionSource interface {
+	// Name returns the platform name of the source, e.g. RARIBLE
+	Name() string
+	// FetchConnections returns the connections found for address, failures are reported
+	// through ConnectionEntryList.Err
+	FetchConnections(ctx context.Context, address string) ConnectionEntryList
+}
+
+type identitySourceFunc struct {
+	name  string
+	fetch func(ctx context.Context, address string) IdentityEntry
+}
+
+// NewIdentitySource wraps a plain function into an IdentitySource
+func NewIdentitySource(name string, fetch func(ctx context.Context, address string) IdentityEntry) IdentitySource {
+	return &identitySourceFunc{name: name, fetch: fetch}
+}
+
+func (s *identitySourceFunc) Name() string {
+	return s.name
+}
+
+func (s *identitySourceFunc) FetchIdentity(ctx context.Context, address string) IdentityEntry {
+	return s.fetch(ctx, address)
+}
+
+type connectionSourceFunc struct {
+	name  string
+	fetch func(ctx context.Context, address string) ConnectionEntryList
+}
+
+// NewConnectionSource wraps a plain function into a ConnectionSource
+func NewConnectionSource(name string, fetch func(ctx context.Context, address string) ConnectionEntryList) ConnectionSource {
+	return &connectionSourceFunc{name: name, fetch: fetch}
+}
+
+func (s *connectionSourceFunc) Name() string {
+	return s.name
+}
+
+func (s *connectionSourceFunc) FetchConnections(ctx context.Context, address string) ConnectionEntryList {
+	return s.fetch(ctx, address)
+}
+
+// builtinIdentitySources lists the identity sources queried when no selection is made
+func (f *fetcher) builtinIdentitySources() []IdentitySource {
+	sources := []IdentitySource{
+		NewIdentitySource(CONTEXT, f.processContext),
+		NewIdentitySource(SUPERRARE, f.processSuperrare),
+		NewIdentitySource(OPENSEA, f.processOpenSea),
+		NewIdentitySource(FOUNDATION, f.processFoundation),
+		NewIdentitySource(SHOWTIME, f.processShowtime),
+		NewIdentitySource(ZORA, f.processZora),
+		NewIdentitySource(RARIBLE, f.processRarible),
+		NewIdentitySource(SYBIL, f.processSybil),
+	}
+	if f.ensBackend != nil {
+		sources = append(sources, NewIdentitySource(ENS, f.processEns))
+	}
+	return sources
+}
+
+// builtinConnectionSources lists the connection sources queried when no selection is made
+func (f *fetcher) builtinConnectionSources() []ConnectionSource {
+	sources := []ConnectionSource{
+		NewConnectionSource(CONTEXT, f.processContextConn),
+		NewConnectionSource(RARIBLE, f.processRaribleConn),
+	}
+	if f.convoApiKey != "" {
+		sources = append(sources, NewConnectionSource(CONVO, f.processConvoConn))
+	}
+	return sources
+}
+
+// BuiltinSources returns the names of the built-in identity and connection sources, whatever
+// the options, e.g. ENS is listed although it is only queried with an Ethereum backend
+func BuiltinSources() []string {
+	f := &fetcher{}
+	names := []string{ENS, CONVO}
+	seen := map[string]bool{ENS: true, CONVO: true}
+	for _, source := range f.builtinIdentitySources() {
+		if !seen[source.Name()] {
+			seen[source.Name()] = true
+			names = append(names, source.Name())
+		}
+	}
+	for _, source := range f.builtinConnectionSources() {
+		if !seen[source.Name()] {
+			seen[source.Name()] = true
+			names = append(names, source.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
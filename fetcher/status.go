@@ -0,0 +1,252 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SourceStatus reports how a single data source behaved during a fetch
+type SourceStatus struct {
+	Source  string
+	Success bool
+	Err     error
+	Msg     string
+	// StatusCode is the HTTP status of the last response the source received, 0 if none
+	StatusCode int
+	Latency    time.Duration
+	FetchedAt  time.Time
+	// Count is the number of records the source contributed
+	Count int
+	// Retries is the number of requests sent again after a retryable failure
+	Retries int
+	// QueueWait is the time requests spent waiting for a host rate limit
+	QueueWait time.Duration
+	// Cache is CacheHit, CacheStale or CacheMiss, empty when no cache is configured
+	Cache string
+}
+
+// MarshalJSON writes Err as its message, error values have no JSON form of their own
+func (s SourceStatus) MarshalJSON() ([]byte, error) {
+	type sourceStatus SourceStatus
+	var errMsg string
+	if s.Err != nil {
+		errMsg = s.Err.Error()
+	}
+	return json.Marshal(struct {
+		sourceStatus
+		Err string `json:",omitempty"`
+	}{sourceStatus(s), errMsg})
+}
+
+// PartialResultError is returned along with the merged results when one or more sources failed
+type PartialResultError struct {
+	Failed []SourceStatus
+}
+
+func (e *PartialResultError) Error() string {
+	var msgs []string
+	for _, status := range e.Failed {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", status.Source, status.Err))
+	}
+	return fmt.Sprintf("%d source(s) failed: %s", len(e.Failed), strings.Join(msgs, "; "))
+}
+
+// FailedSources returns the names of the failed sources
+func (e *PartialResultError) FailedSources() []string {
+	var names []string
+	for _, status := range e.Failed {
+		names = append(names, status.Source)
+	}
+	return names
+}
+
+// sourceTrace collects request level details of a single source run, sendRequest fills it
+// through the request context
+type sourceTrace struct {
+	policy RetryPolicy
+
+	mu         sync.Mutex
+	statusCode int
+	retries    int
+	queueWait  time.Duration
+}
+
+type sourceTraceKey struct{}
+
+func withSourceTrace(ctx context.Context, policy RetryPolicy) (context.Context, *sourceTrace) {
+	trace := &sourceTrace{policy: policy}
+	return context.WithValue(ctx, sourceTraceKey{}, trace), trace
+}
+
+func traceFromContext(ctx context.Context) *sourceTrace {
+	trace, _ := ctx.Value(sourceTraceKey{}).(*sourceTrace)
+	return trace
+}
+
+func (t *sourceTrace) recordStatusCode(code int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.statusCode = code
+	t.mu.Unlock()
+}
+
+func (t *sourceTrace) retryPolicy() RetryPolicy {
+	if t == nil {
+		return DefaultRetryPolicy
+	}
+	return t.policy
+}
+
+func (t *sourceTrace) recordRetry() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.retries++
+	t.mu.Unlock()
+}
+
+func (t *sourceTrace) recordQueueWait(wait time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.queueWait += wait
+	t.mu.Unlock()
+}
+
+func (t *sourceTrace) fill(status *SourceStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status.StatusCode = t.statusCode
+	status.Retries = t.retries
+	status.QueueWait = t.queueWait
+}
+
+type identityResult struct {
+	entry  IdentityEntry
+	status SourceStatus
+}
+
+// runIdentitySource serves the result of source from the cache, or fetches and caches it
+func (f *fetcher) runIdentitySource(ctx context.Context, source IdentitySource, address string) identityResult {
+	if f.cache == nil {
+		return f.fetchIdentitySource(ctx, source, address)
+	}
+
+	key := cacheKey("identity", source.Name(), address)
+	var cached IdentityEntry
+	if item, state := f.cacheGet(source.Name(), key, &cached); state != CacheMiss {
+		if state == CacheStale {
+			f.revalidate(key, func(ctx context.Context) {
+				res := f.fetchIdentitySource(ctx, source, address)
+				f.cacheStore(key, res.entry, res.status)
+			})
+		}
+		return identityResult{entry: cached, status: cachedStatus(source.Name(), item, state, cached.count())}
+	}
+
+	res := f.fetchIdentitySource(ctx, source, address)
+	res.status.Cache = CacheMiss
+	f.cacheStore(key, res.entry, res.status)
+	return res
+}
+
+func (f *fetcher) fetchIdentitySource(ctx context.Context, source IdentitySource, address string) identityResult {
+	ctx, trace := withSourceTrace(ctx, f.retryPolicy(source.Name()))
+	start := time.Now()
+	entry := source.FetchIdentity(ctx, address)
+
+	status := SourceStatus{
+		Source:    source.Name(),
+		Success:   entry.Err == nil,
+		Err:       entry.Err,
+		Msg:       entry.Msg,
+		Latency:   time.Since(start),
+		FetchedAt: time.Now(),
+	}
+	if entry.Err == nil {
+		status.Count = entry.count()
+	}
+	trace.fill(&status)
+	return identityResult{entry: entry, status: status}
+}
+
+type connectionResult struct {
+	entry  ConnectionEntryList
+	status SourceStatus
+}
+
+// runConnectionSource serves the result of source from the cache, or fetches and caches it
+func (f *fetcher) runConnectionSource(ctx context.Context, source ConnectionSource, address string) connectionResult {
+	if f.cache == nil {
+		return f.fetchConnectionSource(ctx, source, address)
+	}
+
+	key := cacheKey("connection", source.Name(), address)
+	var cached ConnectionEntryList
+	if item, state := f.cacheGet(source.Name(), key, &cached); state != CacheMiss {
+		if state == CacheStale {
+			f.revalidate(key, func(ctx context.Context) {
+				res := f.fetchConnectionSource(ctx, source, address)
+				f.cacheStore(key, res.entry, res.status)
+			})
+		}
+		return connectionResult{entry: cached, status: cachedStatus(source.Name(), item, state, len(cached.Conn))}
+	}
+
+	res := f.fetchConnectionSource(ctx, source, address)
+	res.status.Cache = CacheMiss
+	f.cacheStore(key, res.entry, res.status)
+	return res
+}
+
+func (f *fetcher) fetchConnectionSource(ctx context.Context, source ConnectionSource, address string) connectionResult {
+	ctx, trace := withSourceTrace(ctx, f.retryPolicy(source.Name()))
+	start := time.Now()
+	entry := source.FetchConnections(ctx, address)
+
+	status := SourceStatus{
+		Source:    source.Name(),
+		Success:   entry.Err == nil,
+		Err:       entry.Err,
+		Msg:       entry.msg,
+		Latency:   time.Since(start),
+		FetchedAt: time.Now(),
+	}
+	if entry.Err == nil {
+		status.Count = len(entry.Conn)
+	}
+	trace.fill(&status)
+	return connectionResult{entry: entry, status: status}
+}
+
+func cachedStatus(source string, item CacheItem, state string, count int) SourceStatus {
+	return SourceStatus{
+		Source:    source,
+		Success:   true,
+		FetchedAt: item.StoredAt,
+		Count:     count,
+		Cache:     state,
+	}
+}
+
+// partialResultError returns a *PartialResultError for the failed statuses, nil if all succeeded
+func partialResultError(statuses []SourceStatus) error {
+	var failed []SourceStatus
+	for _, status := range statuses {
+		if !status.Success {
+			failed = append(failed, status)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return &PartialResultError{Failed: failed}
+}
@@ -0,0 +1,148 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sybilListTTL is how long a loaded verified-address list is used before it is loaded again
+	sybilListTTL = time.Hour
+	// sybilFailureTTL is how long a failed load is reported before the list is loaded again
+	sybilFailureTTL = time.Minute
+	// sybilLoadTimeout bounds a load, which runs on behalf of every caller waiting for it
+	sybilLoadTimeout = 2 * time.Minute
+)
+
+// WithSybilList reads the Sybil verified-address list from location, either an http(s) URL
+// or a local file, instead of SybilUrl
+func WithSybilList(location string) Option {
+	return func(f *fetcher) {
+		f.sybilList.location = location
+	}
+}
+
+// sybilList caches the Sybil verified-address list keyed by lowercase address
+type sybilList struct {
+	location string
+
+	mu      sync.Mutex
+	entries map[string]SybilVerification
+	loaded  time.Time
+	// loading is closed once the load in flight, if any, is done
+	loading chan struct{}
+	// err is the error of the last load, failed when it happened
+	err    error
+	failed time.Time
+}
+
+// sybilVerification returns the verification of address. The list is loaded once for all
+// concurrent callers, a stale list is served while it is reloaded in the background, and a
+// failed load is reported for sybilFailureTTL before it is tried again.
+func (f *fetcher) sybilVerification(ctx context.Context, address string) (SybilVerification, bool, error) {
+	l := &f.sybilList
+	for {
+		l.mu.Lock()
+		recentFailure := l.err != nil && time.Since(l.failed) < sybilFailureTTL
+		if l.loading == nil && !recentFailure && (l.entries == nil || time.Since(l.loaded) > sybilListTTL) {
+			l.loading = make(chan struct{})
+			go f.reloadSybilList()
+		}
+		if l.entries != nil {
+			verification, ok := l.entries[strings.ToLower(address)]
+			l.mu.Unlock()
+			return verification, ok, nil
+		}
+		if recentFailure {
+			err := l.err
+			l.mu.Unlock()
+			return SybilVerification{}, false, err
+		}
+		loading := l.loading
+		l.mu.Unlock()
+
+		select {
+		case <-loading:
+		case <-ctx.Done():
+			return SybilVerification{}, false, ctx.Err()
+		}
+	}
+}
+
+// reloadSybilList loads the list into f.sybilList, detached from the callers' contexts
+func (f *fetcher) reloadSybilList() {
+	ctx, cancel := context.WithTimeout(context.Background(), sybilLoadTimeout)
+	defer cancel()
+	ctx, _ = withSourceTrace(ctx, f.retryPolicy(SYBIL))
+	entries, err := f.loadSybilList(ctx)
+
+	l := &f.sybilList
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err != nil {
+		l.err, l.failed = err, time.Now()
+	} else {
+		l.entries, l.loaded, l.err = entries, time.Now(), nil
+	}
+	close(l.loading)
+	l.loading = nil
+}
+
+func (f *fetcher) loadSybilList(ctx context.Context) (map[string]SybilVerification, error) {
+	location := f.sybilList.location
+	if location == "" {
+		location = f.sourceURL(SYBIL, SybilUrl)
+	}
+
+	var body []byte
+	var err error
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		body, err = sendRequest(ctx, f.httpClient, RequestArgs{
+			url:    location,
+			method: "GET",
+		})
+	} else {
+		body, err = ioutil.ReadFile(location)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list map[string]SybilVerification
+	err = json.Unmarshal(body, &list)
+	if err != nil {
+		return nil, err
+	}
+	// The list is keyed by checksummed address
+	entries := make(map[string]SybilVerification, len(list))
+	for address, verification := range list {
+		entries[strings.ToLower(address)] = verification
+	}
+	return entries, nil
+}
+
+func (f *fetcher) processSybil(ctx context.Context, address string) IdentityEntry {
+	var result IdentityEntry
+
+	verification, ok, err := f.sybilVerification(ctx, address)
+	if err != nil {
+		result.Err = err
+		result.Msg = "[processSybil] load verified list failed"
+		return result
+	}
+	if !ok || verification.Twitter.Handle == "" {
+		return result
+	}
+
+	result.Twitter = &UserTwitterIdentity{
+		Handle:     verification.Twitter.Handle,
+		Verified:   true,
+		TweetID:    verification.Twitter.TweetID,
+		DataSource: SYBIL,
+	}
+	return result
+}
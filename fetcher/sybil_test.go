@@ -0,0 +1,99 @@
+package fetcher
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testSybilList = `{"0x983110309620D911731Ac0932219af06091b6744": {"twitter": {"timestamp": 1, "tweetID": "42", "handle": "brantlymillegan"}}}`
+
+func TestSybilListLoadedOnce(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+	f := newTestFetcher(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		w.Write([]byte(testSybilList))
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			verification, ok, err := f.sybilVerification(context.Background(), "0x983110309620d911731ac0932219af06091b6744")
+			if err != nil || !ok || verification.Twitter.Handle != "brantlymillegan" {
+				t.Errorf("got %+v, %v, %v", verification, ok, err)
+			}
+		}()
+	}
+
+	// A caller giving up does not wait for the load
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := f.sybilVerification(ctx, testAddress); err != context.DeadlineExceeded {
+		t.Errorf("err = %v", err)
+	}
+
+	close(release)
+	wg.Wait()
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("list loaded %d times", requests)
+	}
+}
+
+func TestSybilListFailureRemembered(t *testing.T) {
+	var requests int32
+	f := newTestFetcher(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := f.sybilVerification(context.Background(), testAddress); err == nil {
+			t.Fatal("expected an error")
+		}
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("list loaded %d times", requests)
+	}
+
+	// Once the failure is old enough the list is loaded again
+	f.sybilList.mu.Lock()
+	f.sybilList.failed = time.Now().Add(-sybilFailureTTL)
+	f.sybilList.mu.Unlock()
+	f.sybilVerification(context.Background(), testAddress)
+	if atomic.LoadInt32(&requests) != 2 {
+		t.Errorf("list loaded %d times", requests)
+	}
+}
+
+func TestProcessSybil(t *testing.T) {
+	f := newTestFetcher(t, respond(http.StatusOK, testSybilList))
+
+	entry := f.processSybil(noRetryContext(), testAddress)
+	if entry.Err != nil {
+		t.Fatalf("unexpected error: %v", entry.Err)
+	}
+	want := UserTwitterIdentity{Handle: "brantlymillegan", Verified: true, TweetID: "42", DataSource: SYBIL}
+	if entry.Twitter == nil || *entry.Twitter != want {
+		t.Errorf("twitter = %+v, want %+v", entry.Twitter, want)
+	}
+
+	if entry := f.processSybil(noRetryContext(), testFollowing); entry.Err != nil || entry.count() != 0 {
+		t.Errorf("got %+v for an address not on the list", entry)
+	}
+}
+
+func TestProcessSybilErrors(t *testing.T) {
+	testProcessErrors(t, func(f *fetcher) IdentityEntry {
+		return f.processSybil(noRetryContext(), testAddress)
+	}, []processErrorTest{
+		{"http error", respond(http.StatusNotFound, ""), "[processSybil] load verified list failed"},
+		{"malformed json", respond(http.StatusOK, `{"0x983110309620D911731Ac0932219af06091b6744": []}`), "[processSybil] load verified list failed"},
+	})
+}
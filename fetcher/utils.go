@@ -2,16 +2,36 @@ package fetcher
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"regexp"
 	"time"
-
-	"go.uber.org/zap"
 )
 
+// HTTPError is returned by sendRequest when the response status is not 200
+type HTTPError struct {
+	StatusCode int
+	// URL is the request URL without its query string, which may carry API keys
+	URL string
+	// RetryAfter is the delay asked for by the Retry-After header, 0 if none
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("Response code: %d", e.StatusCode)
+}
+
+// isNotFound reports whether err is a 404 response, which platforms answer for unknown users
+func isNotFound(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound
+}
+
 type RequestArgs struct {
 	url    string
 	method string
@@ -20,13 +40,39 @@ type RequestArgs struct {
 	body   []byte
 }
 
-func sendRequest(client *http.Client, args RequestArgs) ([]byte, error) {
+// sendRequest sends the request, retrying it according to the retry policy of the calling source
+func sendRequest(ctx context.Context, client *http.Client, args RequestArgs) ([]byte, error) {
+	trace := traceFromContext(ctx)
+	policy := trace.retryPolicy()
+	for attempt := 0; ; attempt++ {
+		body, err := doRequest(ctx, client, args)
+		if err == nil || attempt >= policy.MaxRetries || !isRetryable(ctx, err) {
+			return body, err
+		}
+
+		delay := policy.backoff(attempt)
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && httpErr.RetryAfter > delay {
+			// Waiting hours for a rate limit to reset is worse than failing the source
+			if httpErr.RetryAfter > policy.maxRetryAfter() {
+				return body, err
+			}
+			delay = httpErr.RetryAfter
+		}
+		trace.recordRetry()
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func doRequest(ctx context.Context, client *http.Client, args RequestArgs) ([]byte, error) {
 	var req *http.Request
 	var err error
 
 	switch args.method {
 	case "GET":
-		req, err = http.NewRequest(args.method, args.url, nil)
+		req, err = http.NewRequestWithContext(ctx, args.method, args.url, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -40,7 +86,7 @@ func sendRequest(client *http.Client, args RequestArgs) ([]byte, error) {
 		req.URL.RawQuery = query.Encode()
 
 	case "POST":
-		req, err = http.NewRequest(args.method, args.url, bytes.NewBuffer(args.body))
+		req, err = http.NewRequestWithContext(ctx, args.method, args.url, bytes.NewBuffer(args.body))
 		if err != nil {
 			return nil, err
 		}
@@ -55,11 +101,21 @@ func sendRequest(client *http.Client, args RequestArgs) ([]byte, error) {
 	req.Header.Add("Content-Type", "application/json")
 	resp, err := client.Do(req)
 	if err != nil {
+		// Transport errors quote the URL, keep API keys out of them
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = redactQuery(urlErr.URL)
+		}
 		return nil, err
 	}
 	defer resp.Body.Close()
+	traceFromContext(ctx).recordStatusCode(resp.StatusCode)
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Response code: %d", resp.StatusCode)
+		return nil, &HTTPError{
+			StatusCode: resp.StatusCode,
+			URL:        redactQuery(args.url),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
 	}
 
 	respBody, err := ioutil.ReadAll(resp.Body)
@@ -70,6 +126,16 @@ func sendRequest(client *http.Client, args RequestArgs) ([]byte, error) {
 	return respBody, nil
 }
 
+// redactQuery removes the query string of rawURL, which may carry API keys
+func redactQuery(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	u.RawQuery, u.ForceQuery = "", false
+	return u.String()
+}
+
 func httpClient() *http.Client {
 	client := new(http.Client)
 	var transport http.RoundTripper = &http.Transport{
@@ -94,50 +160,3 @@ func httpClient() *http.Client {
 func isAddress(address string) bool {
 	return regexp.MustCompile("^(0x)?[0-9a-fA-F]{40}$").MatchString(address)
 }
-
-func convertTwitterHandle(inputHandle string) string {
-	retHandle := inputHandle
-
-	// Solution 1.1 - some inputs begin with "https://twitter.com"
-	re1_1, _ := regexp.Compile(`\bhttps://twitter.com/`)
-	if re1_1.MatchString(retHandle) && len(retHandle) > 20 {
-		retHandle = retHandle[20:]
-	}
-
-	// Solution 1.2 - some inputs begin with "https://twitter/"
-	re1_2, _ := regexp.Compile(`\bhttps://twitter/`)
-	if re1_2.MatchString(retHandle) && len(retHandle) > 16 {
-		retHandle = retHandle[16:]
-	}
-
-	// Solution 1.3 - some inputs begin with "www.twitter.com/"
-	re1_3, _ := regexp.Compile(`\bwww.twitter.com/`)
-	if re1_3.MatchString(retHandle) && len(retHandle) > 16 {
-		retHandle = retHandle[16:]
-	}
-
-	// Solution 2 - some inputs begin with "@"
-	re2, _ := regexp.Compile(`[@]{1}`)
-	if re2.MatchString(retHandle) && len(retHandle) > 1 {
-		retHandle = retHandle[1:]
-	}
-
-	// Solution 3 - some inputs begin with "/"
-	if retHandle[0] == '/' {
-		retHandle = retHandle[1:]
-	}
-
-	// Solution 4 - some inputs ends with "/"
-	if retHandle[len(retHandle)-1] == '/' {
-		retHandle = retHandle[:len(retHandle)-1]
-	}
-
-	// Final Check - if retHandle still contains special characters, report it
-	// will fix them in future
-	re0, _ := regexp.Compile(`\W+`)
-	if re0.MatchString(retHandle) {
-		zap.L().With(zap.Any("handle", retHandle)).Error("Unqualified Twitter Handle")
-	}
-
-	return retHandle
-}
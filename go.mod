@@ -5,6 +5,7 @@ go 1.16
 require (
 	github.com/INFURA/go-ethlibs v0.0.0-20211116205627-f2f12daece2c
 	github.com/ethereum/go-ethereum v1.10.12
+	github.com/graph-gophers/graphql-go v1.3.0
 	github.com/imdario/mergo v0.3.12
 	github.com/ryboe/q v1.0.15 // indirect
 	github.com/wealdtech/go-ens/v3 v3.5.1
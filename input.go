@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// readAddresses collects addresses from args, the file at path and stdin. Stdin is read when
+// an argument is "-", or when there are neither arguments nor a file.
+func readAddresses(args []string, path string, stdin io.Reader) ([]string, error) {
+	var addresses []string
+	readStdin := len(args) == 0 && path == ""
+	for _, arg := range args {
+		if arg == "-" {
+			readStdin = true
+			continue
+		}
+		addresses = append(addresses, arg)
+	}
+
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		fromFile, err := scanAddresses(file)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, fromFile...)
+	}
+	if readStdin {
+		fromStdin, err := scanAddresses(stdin)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, fromStdin...)
+	}
+	return addresses, nil
+}
+
+// scanAddresses reads whitespace or comma separated addresses, skipping "#" comments
+func scanAddresses(r io.Reader) ([]string, error) {
+	var addresses []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		addresses = append(addresses, strings.FieldsFunc(line, func(c rune) bool {
+			return c == ',' || c == ' ' || c == '\t'
+		})...)
+	}
+	return addresses, scanner.Err()
+}
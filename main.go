@@ -2,27 +2,47 @@ package main
 
 import (
 	"fmt"
-
-	"github.com/cyberconnecthq/indexer/fetcher"
+	"os"
 )
 
-const (
-	// address = "0xd8da6bf26964af9d7eed9e03e53415d37aa96045" // vitalik.eth
-	address = "0x983110309620d911731ac0932219af06091b6744" // brantly.eth
-)
+const usage = `Usage: indexer <command> [flags] [address|ens ...]
+
+Commands:
+  identity     fetch the identity of addresses
+  connections  fetch the followings and followers of addresses
+  crawl        walk the connection graph outward from addresses
+  serve        serve identities and connections over a JSON HTTP API
+
+Addresses are read from the arguments, from -file, or from stdin when neither is given
+or the argument is "-". Run "indexer <command> -h" for the flags of a command.
+`
 
 func main() {
-	f := fetcher.NewFetcher()
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
 
-	ids, err := f.FetchIdentity(address)
-	if err != nil {
-		fmt.Println(err)
+	var err error
+	switch os.Args[1] {
+	case "identity":
+		err = runIdentity(os.Args[2:])
+	case "connections":
+		err = runConnections(os.Args[2:])
+	case "crawl":
+		err = runCrawl(os.Args[2:])
+	case "serve":
+		err = runServe(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
 	}
-	fmt.Printf("%+v\n", ids)
 
-	conn, err := f.FetchConnections(address)
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, "indexer:", err)
+		os.Exit(1)
 	}
-	fmt.Printf("%+v\n", conn)
 }
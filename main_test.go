@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cyberconnecthq/indexer/fetcher"
+)
+
+func TestScanAddresses(t *testing.T) {
+	input := "0xaaa, 0xbbb\n# comment\n\n0xccc\tvitalik.eth # trailing\n"
+	got, err := scanAddresses(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"0xaaa", "0xbbb", "0xccc", "vitalik.eth"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestReadAddresses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "indexer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "addresses.txt")
+	if err := ioutil.WriteFile(path, []byte("0xfile\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		args  []string
+		path  string
+		stdin string
+		want  []string
+	}{
+		{"args only", []string{"0xarg"}, "", "0xstdin", []string{"0xarg"}},
+		{"stdin when empty", nil, "", "0xstdin", []string{"0xstdin"}},
+		{"dash reads stdin", []string{"0xarg", "-"}, "", "0xstdin", []string{"0xarg", "0xstdin"}},
+		{"file", []string{"0xarg"}, path, "0xstdin", []string{"0xarg", "0xfile"}},
+		{"file without args", nil, path, "0xstdin", []string{"0xfile"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readAddresses(tt.args, tt.path, strings.NewReader(tt.stdin))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteConnections(t *testing.T) {
+	outputs := []connectionsOutput{{
+		Input:   "0xaaa",
+		Address: "0xaaa",
+		Connections: &fetcher.ConnectionResult{Conn: []fetcher.ConnectionEntry{
+			{From: "0xaaa", To: "0xbbb", Platform: fetcher.RARIBLE},
+			{From: "0xccc", To: "0xaaa", Platform: fetcher.CONTEXT},
+		}},
+	}, {
+		Input: "nobody.eth",
+		Error: "failed",
+	}}
+
+	var buf bytes.Buffer
+	if err := writeConnections(&buf, formatCSV, outputs); err != nil {
+		t.Fatal(err)
+	}
+	want := "ADDRESS,FROM,TO,PLATFORM,DIRECTION\n" +
+		"0xaaa,0xaaa,0xbbb,Rarible,following\n" +
+		"0xaaa,0xccc,0xaaa,Context,follower\n"
+	if buf.String() != want {
+		t.Errorf("csv got\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := writeConnections(&buf, formatTable, outputs); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "ADDRESS  FROM") {
+		t.Errorf("unexpected table\n%s", buf.String())
+	}
+}
+
+func TestWriteEdges(t *testing.T) {
+	seen := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+	edges := []fetcher.ConnectionEdge{
+		{From: "0xaaa", To: "0xbbb", Platforms: []string{fetcher.RARIBLE, fetcher.CONTEXT}, FirstSeen: seen},
+		{From: "0xbbb", To: "0xaaa", Platforms: []string{fetcher.CONVO}},
+	}
+
+	var buf bytes.Buffer
+	if err := writeEdges(&buf, formatCSV, edges); err != nil {
+		t.Fatal(err)
+	}
+	want := "FROM,TO,PLATFORMS,FIRST_SEEN\n" +
+		"0xaaa,0xbbb,\"Rarible,Context\",2021-11-01T00:00:00Z\n" +
+		"0xbbb,0xaaa,Convo,\n"
+	if buf.String() != want {
+		t.Errorf("csv got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestSourceNames(t *testing.T) {
+	c := commonFlags{sources: "Rarible, Context"}
+	names, err := c.sourceNames()
+	if err != nil || !reflect.DeepEqual(names, []string{fetcher.RARIBLE, fetcher.CONTEXT}) {
+		t.Errorf("got %v, %v", names, err)
+	}
+
+	c.sources = "Rarible,Twtter"
+	if _, err := c.sourceNames(); err == nil || !strings.Contains(err.Error(), `"Twtter"`) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestMergeOptions(t *testing.T) {
+	c := commonFlags{priority: "Context,Superrare"}
+	options, err := c.mergeOptions()
+	if err != nil || !reflect.DeepEqual(options.SourcePriority, []string{fetcher.CONTEXT, fetcher.SUPERRARE}) {
+		t.Errorf("got %+v, %v", options, err)
+	}
+
+	c.priority = "Context,Nowhere"
+	if _, err := c.mergeOptions(); err == nil {
+		t.Error("expected an error for an unknown source")
+	}
+}
+
+// graphFetcher serves the connections of a canned graph, addresses missing from it fail
+type graphFetcher struct {
+	graph   map[string][]fetcher.ConnectionEntry
+	fetched []string
+}
+
+func (f *graphFetcher) FetchConnections(address string) (fetcher.ConnectionResult, error) {
+	return f.FetchConnectionsWithContext(context.Background(), address)
+}
+
+func (f *graphFetcher) FetchConnectionsWithContext(ctx context.Context, address string) (fetcher.ConnectionResult, error) {
+	f.fetched = append(f.fetched, address)
+	conns, ok := f.graph[address]
+	if !ok {
+		return fetcher.ConnectionResult{}, errors.New("unreachable")
+	}
+	return fetcher.ConnectionResult{Conn: conns}, nil
+}
+
+func (f *graphFetcher) FetchIdentity(address string) (fetcher.IdentityEntryList, error) {
+	return fetcher.IdentityEntryList{}, nil
+}
+
+func (f *graphFetcher) FetchIdentityWithContext(ctx context.Context, address string) (fetcher.IdentityEntryList, error) {
+	return fetcher.IdentityEntryList{}, nil
+}
+
+func (f *graphFetcher) ResolveAddress(ctx context.Context, input string) (string, error) {
+	if strings.HasSuffix(input, ".eth") {
+		return "", errors.New("no ENS backend")
+	}
+	return input, nil
+}
+
+func TestCrawl(t *testing.T) {
+	const (
+		a = "0x00000000000000000000000000000000000000aa"
+		b = "0x00000000000000000000000000000000000000bb"
+		c = "0x00000000000000000000000000000000000000cc"
+	)
+	f := &graphFetcher{graph: map[string][]fetcher.ConnectionEntry{
+		a: {{From: a, To: b, Platform: fetcher.RARIBLE}, {From: a, To: "bob.eth", Platform: fetcher.CONTEXT}},
+		b: {{From: b, To: c, Platform: fetcher.RARIBLE}},
+	}}
+
+	conns, failed := crawl(f, []string{a}, 2, 10, time.Second)
+	if failed || len(conns) != 3 {
+		t.Errorf("got %+v, failed %v", conns, failed)
+	}
+	// The unresolved name is not fetched
+	if fmt.Sprint(f.fetched) != fmt.Sprint([]string{a, b}) {
+		t.Errorf("fetched %v", f.fetched)
+	}
+
+	// c has no connections to fetch, it fails
+	f.fetched = nil
+	if _, failed := crawl(f, []string{c, a}, 1, 10, time.Second); !failed {
+		t.Error("failure of an address not reported")
+	}
+	if _, failed := crawl(f, []string{"nobody.eth"}, 1, 10, time.Second); !failed {
+		t.Error("unresolved seed not reported")
+	}
+}
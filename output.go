@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cyberconnecthq/indexer/fetcher"
+)
+
+const (
+	formatJSON  = "json"
+	formatTable = "table"
+	formatCSV   = "csv"
+)
+
+func writeIdentities(w io.Writer, format string, outputs []identityOutput) error {
+	if format == formatJSON {
+		return writeJSON(w, outputs)
+	}
+	header := []string{"ADDRESS", "PLATFORM", "FIELD", "VALUE", "SOURCE", "CONFIDENCE"}
+	var rows [][]string
+	for _, output := range outputs {
+		if output.Identity == nil {
+			continue
+		}
+		for _, attribute := range output.Identity.Attributes {
+			rows = append(rows, []string{
+				output.Address, attribute.Platform, attribute.Field, attribute.Value,
+				attribute.Source, attribute.Confidence.String(),
+			})
+		}
+	}
+	return writeRows(w, format, header, rows)
+}
+
+func writeConnections(w io.Writer, format string, outputs []connectionsOutput) error {
+	if format == formatJSON {
+		return writeJSON(w, outputs)
+	}
+	header := []string{"ADDRESS", "FROM", "TO", "PLATFORM", "DIRECTION"}
+	var rows [][]string
+	for _, output := range outputs {
+		if output.Connections == nil {
+			continue
+		}
+		for _, conn := range output.Connections.Conn {
+			direction := "follower"
+			if strings.EqualFold(conn.From, output.Address) {
+				direction = "following"
+			}
+			rows = append(rows, []string{output.Address, conn.From, conn.To, conn.Platform, direction})
+		}
+	}
+	return writeRows(w, format, header, rows)
+}
+
+func writeEdges(w io.Writer, format string, edges []fetcher.ConnectionEdge) error {
+	if format == formatJSON {
+		return writeJSON(w, edges)
+	}
+	header := []string{"FROM", "TO", "PLATFORMS", "FIRST_SEEN"}
+	var rows [][]string
+	for _, edge := range edges {
+		firstSeen := ""
+		if !edge.FirstSeen.IsZero() {
+			firstSeen = edge.FirstSeen.UTC().Format(time.RFC3339)
+		}
+		rows = append(rows, []string{edge.From, edge.To, strings.Join(edge.Platforms, ","), firstSeen})
+	}
+	return writeRows(w, format, header, rows)
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// writeRows writes a header and rows as an aligned table or as csv
+func writeRows(w io.Writer, format string, header []string, rows [][]string) error {
+	if format == formatCSV {
+		writer := csv.NewWriter(w)
+		writer.Write(header)
+		writer.WriteAll(rows)
+		return writer.Error()
+	}
+
+	writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	return writer.Flush()
+}
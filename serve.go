@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cyberconnecthq/indexer/server"
+)
+
+func runServe(args []string) error {
+	var c commonFlags
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.StringVar(&c.sources, "sources", "", "comma separated sources to query, e.g. Context,Rarible (default all)")
+	fs.StringVar(&c.rpc, "rpc", os.Getenv("ETH_RPC_URL"), "Ethereum JSON-RPC `url` for ENS lookups (default $ETH_RPC_URL)")
+	fs.StringVar(&c.convoKey, "convo-key", os.Getenv("CONVO_API_KEY"), "Convo API `key`, Convo is skipped without one (default $CONVO_API_KEY)")
+	c.addPriorityFlag(fs)
+	addr := fs.String("addr", ":8080", "address to listen on")
+	timeout := fs.Duration("timeout", server.DefaultTimeout, "timeout per request")
+	maxBatchSize := fs.Int("max-batch", server.DefaultMaxBatchSize, "maximum number of items of a batch request")
+	drain := fs.Duration("drain", 5*time.Second, "time to report not ready before shutting down")
+	if err := fs.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if _, err := c.sourceNames(); err != nil {
+		return flagError(err)
+	}
+	mergeOptions, err := c.mergeOptions()
+	if err != nil {
+		return flagError(err)
+	}
+
+	s := server.New(c.newFetcher(), server.WithTimeout(*timeout), server.WithMaxBatchSize(*maxBatchSize),
+		server.WithMergeOptions(mergeOptions))
+	httpServer := &http.Server{Addr: *addr, Handler: s}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- httpServer.ListenAndServe()
+	}()
+	fmt.Fprintln(os.Stderr, "listening on", *addr)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-errCh:
+		return err
+	case <-signals:
+	}
+
+	// Fail readiness first so that load balancers stop sending requests, then drain
+	s.SetReady(false)
+	time.Sleep(*drain)
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	return httpServer.Shutdown(ctx)
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// maxBatchBody bounds the size of a batch request body
+const maxBatchBody = 1 << 20
+
+// Types of batch items
+const (
+	BatchIdentity    = "identity"
+	BatchConnections = "connections"
+)
+
+// BatchRequest is the body of POST /v1/batch
+type BatchRequest struct {
+	Requests []BatchItem
+}
+
+// BatchItem asks for the identity or the connections of Address, connections items are filtered
+// and paged by the embedded query
+type BatchItem struct {
+	Type    string
+	Address string
+	ConnectionsQuery
+}
+
+// BatchResult answers the BatchItem at the same position, exactly one of Identity, Connections
+// and Error is set
+type BatchResult struct {
+	Type        string
+	Address     string
+	Identity    *IdentityResponse    `json:",omitempty"`
+	Connections *ConnectionsResponse `json:",omitempty"`
+	Error       *Error               `json:",omitempty"`
+}
+
+// BatchResponse is the body of a POST /v1/batch response
+type BatchResponse struct {
+	Results []BatchResult
+}
+
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req BatchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBody)).Decode(&req); err != nil {
+		writeError(w, &Error{Status: http.StatusBadRequest, Message: "invalid batch request: " + err.Error()})
+		return
+	}
+	if len(req.Requests) == 0 {
+		writeError(w, &Error{Status: http.StatusBadRequest, Message: "batch request has no item"})
+		return
+	}
+	if s.maxBatchSize > 0 && len(req.Requests) > s.maxBatchSize {
+		writeError(w, &Error{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("batch request has %d items, at most %d are allowed", len(req.Requests), s.maxBatchSize),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+
+	// Items are answered independently, one failing does not fail the batch
+	results := make([]BatchResult, len(req.Requests))
+	concurrency := s.batchConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, item := range req.Requests {
+		wg.Add(1)
+		go func(i int, item BatchItem) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results[i] = BatchResult{Type: item.Type, Address: item.Address, Error: contextError(ctx)}
+				return
+			}
+			results[i] = s.batchItem(ctx, item)
+			<-sem
+		}(i, item)
+	}
+	wg.Wait()
+
+	if r.Context().Err() != nil {
+		// The client went away
+		return
+	}
+	writeJSON(w, http.StatusOK, BatchResponse{Results: results})
+}
+
+func (s *Server) batchItem(ctx context.Context, item BatchItem) BatchResult {
+	result := BatchResult{Type: item.Type, Address: item.Address}
+	switch item.Type {
+	case BatchIdentity:
+		result.Identity, result.Error = s.identity(ctx, item.Address)
+	case BatchConnections:
+		query := item.ConnectionsQuery
+		if result.Error = query.validate(); result.Error == nil {
+			result.Connections, result.Error = s.connections(ctx, item.Address, query)
+		}
+	default:
+		result.Error = &Error{Status: http.StatusBadRequest, Message: fmt.Sprintf("unknown type %q, use identity or connections", item.Type)}
+	}
+	return result
+}
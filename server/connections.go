@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cyberconnecthq/indexer/fetcher"
+)
+
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// Directions of the direction filter, relative to the queried address
+const (
+	DirectionAll       = fetcher.DirectionAll
+	DirectionFollowing = fetcher.DirectionFollowing
+	DirectionFollower  = fetcher.DirectionFollower
+	DirectionMutual    = fetcher.DirectionMutual
+)
+
+// ConnectionsQuery filters and pages the connections of an address
+type ConnectionsQuery struct {
+	// Platforms keeps the connections of these platforms only, all when empty
+	Platforms []string
+	Direction string
+	// Limit is the page size, DefaultPageSize when 0, i.e. left out of a batch item
+	Limit int
+	// Cursor is the NextCursor of the previous page, empty for the first page
+	Cursor string
+}
+
+// ConnectionsResponse is the body of GET /v1/connections/{address}
+type ConnectionsResponse struct {
+	Address string
+	Conn    []fetcher.ConnectionEntry
+	// Total is the number of connections matching the filters across all pages
+	Total int
+	// NextCursor fetches the next page, empty on the last page
+	NextCursor string `json:",omitempty"`
+	// Summary counts the connections of every platform, regardless of the filters
+	Summary fetcher.ConnectionSummary
+	// Failed lists the sources that failed, the response is partial when it is not empty
+	Failed []fetcher.SourceStatus `json:",omitempty"`
+}
+
+func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request, input string) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	query, err := parseConnectionsQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+
+	resp, err := s.connections(ctx, input, query)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func parseConnectionsQuery(values url.Values) (ConnectionsQuery, *Error) {
+	query := ConnectionsQuery{
+		Direction: values.Get("direction"),
+		Cursor:    values.Get("cursor"),
+	}
+	for _, platforms := range values["platform"] {
+		for _, platform := range strings.Split(platforms, ",") {
+			if platform != "" {
+				query.Platforms = append(query.Platforms, platform)
+			}
+		}
+	}
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return query, &Error{Status: http.StatusBadRequest, Message: "limit must be a number"}
+		}
+		// An explicit limit of 0 is no page size, only a missing one takes the default
+		if n == 0 {
+			return query, limitError()
+		}
+		query.Limit = n
+	}
+	return query, query.validate()
+}
+
+func (q *ConnectionsQuery) validate() *Error {
+	switch q.Direction {
+	case "":
+		q.Direction = DirectionAll
+	case DirectionAll, DirectionFollowing, DirectionFollower, DirectionMutual:
+	default:
+		return &Error{Status: http.StatusBadRequest, Message: "direction must be one of all, following, follower or mutual"}
+	}
+	if q.Limit < 0 || q.Limit > MaxPageSize {
+		return limitError()
+	}
+	if q.Limit == 0 {
+		q.Limit = DefaultPageSize
+	}
+	if _, err := q.offset(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func limitError() *Error {
+	return &Error{Status: http.StatusBadRequest, Message: "limit must be between 1 and " + strconv.Itoa(MaxPageSize)}
+}
+
+// offset decodes Cursor, which is the position of the first connection of the page
+func (q ConnectionsQuery) offset() (int, *Error) {
+	if q.Cursor == "" {
+		return 0, nil
+	}
+	offset, err := strconv.Atoi(q.Cursor)
+	if err != nil || offset < 0 {
+		return 0, &Error{Status: http.StatusBadRequest, Message: "invalid cursor"}
+	}
+	return offset, nil
+}
+
+func (s *Server) connections(ctx context.Context, input string, query ConnectionsQuery) (*ConnectionsResponse, *Error) {
+	address, err := s.resolve(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	result, fetchErr := s.fetcher.FetchConnectionsWithContext(ctx, address)
+	failed, err := checkFetchError(ctx, fetchErr, result.Sources)
+	if err != nil {
+		return nil, err
+	}
+
+	conns := filterConnections(address, result.Conn, query)
+	offset, _ := query.offset()
+	resp := &ConnectionsResponse{
+		Address: address,
+		Total:   len(conns),
+		Summary: result.Summary,
+		Failed:  failed,
+	}
+	if offset < len(conns) {
+		end := offset + query.Limit
+		if end < len(conns) {
+			resp.NextCursor = strconv.Itoa(end)
+		} else {
+			end = len(conns)
+		}
+		resp.Conn = conns[offset:end]
+	}
+	return resp, nil
+}
+
+// filterConnections keeps the conns of the query platforms in the query direction relative to
+// address. A mutual is an address both following and followed by address on the kept platforms.
+func filterConnections(address string, conns []fetcher.ConnectionEntry, query ConnectionsQuery) []fetcher.ConnectionEntry {
+	var kept []fetcher.ConnectionEntry
+	for _, conn := range conns {
+		if len(query.Platforms) == 0 || containsFold(query.Platforms, conn.Platform) {
+			kept = append(kept, conn)
+		}
+	}
+	return fetcher.FilterConnections(address, kept, query.Direction)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
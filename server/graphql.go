@@ -0,0 +1,379 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cyberconnecthq/indexer/fetcher"
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+const (
+	// MaxGraphQLDepth is the deepest selection a query may make, enough for the identities of
+	// the followers of followers
+	MaxGraphQLDepth = 8
+	// MaxNestedPageSize is the largest page of followings or followers of an address reached
+	// through another page, every node of which can cost upstream fetches
+	MaxNestedPageSize = 20
+)
+
+// Schema is the GraphQL schema served at /v1/graphql. Every field of Address is resolved on
+// demand, e.g. the followers of an address along with their Twitter handles,
+//
+//	{ address(id: "brantly.eth") { followers(first: 10) { nodes { id identity { twitter } } } } }
+const Schema = `
+schema {
+	query: Query
+}
+
+type Query {
+	# address looks up an address or ENS name
+	address(id: String!): Address
+	addresses(ids: [String!]!): [Address]!
+}
+
+type Address {
+	# id is the lowercase address
+	id: String!
+	ens: String
+	identity: Identity
+	# first is 100 by default, nested pages have at most 20 nodes and 20 by default
+	followings(platforms: [String!], first: Int, after: String): AddressPage!
+	followers(platforms: [String!], first: Int, after: String): AddressPage!
+}
+
+type AddressPage {
+	# totalCount is the number of addresses across all pages
+	totalCount: Int!
+	# nextCursor is the after argument of the next page, null on the last page
+	nextCursor: String
+	nodes: [Address!]!
+}
+
+type Identity {
+	displayName: String
+	bio: String
+	avatar: String
+	twitter: String
+	websites: [String!]!
+	socials: [SocialHandle!]!
+	sources: [SourceStatus!]!
+}
+
+type SocialHandle {
+	platform: String!
+	handle: String!
+	url: String
+	sources: [String!]!
+}
+
+type SourceStatus {
+	source: String!
+	success: Boolean!
+	error: String
+	statusCode: Int!
+	latencyMs: Int!
+	cache: String
+}
+`
+
+// graphqlRequest is the body of POST /v1/graphql
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+func (s *Server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req graphqlRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBody)).Decode(&req); err != nil {
+		writeError(w, &Error{Status: http.StatusBadRequest, Message: "invalid graphql request: " + err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+	resp := s.schema.Exec(s.withLoaders(ctx), req.Query, req.OperationName, req.Variables)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type queryResolver struct {
+	s *Server
+}
+
+func (q *queryResolver) Address(ctx context.Context, args struct{ ID string }) (*addressResolver, error) {
+	address, err := q.s.resolve(ctx, args.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &addressResolver{s: q.s, address: address}, nil
+}
+
+// Addresses resolves every id on its own, ids that do not resolve are null. Like batch requests,
+// at most maxBatchSize ids are allowed.
+func (q *queryResolver) Addresses(ctx context.Context, args struct{ IDs []string }) ([]*addressResolver, error) {
+	if q.s.maxBatchSize > 0 && len(args.IDs) > q.s.maxBatchSize {
+		return nil, &Error{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("addresses has %d ids, at most %d are allowed", len(args.IDs), q.s.maxBatchSize),
+		}
+	}
+	var results []*addressResolver
+	for _, id := range args.IDs {
+		address, err := q.Address(ctx, struct{ ID string }{id})
+		if err != nil {
+			address = nil
+		}
+		results = append(results, address)
+	}
+	return results, nil
+}
+
+type addressResolver struct {
+	s       *Server
+	address string
+	// nested is set for the nodes of a page, whose own pages are limited to MaxNestedPageSize
+	nested bool
+}
+
+func (a *addressResolver) ID() string {
+	return a.address
+}
+
+func (a *addressResolver) Ens(ctx context.Context) (*string, error) {
+	value, err := a.identity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return optional(value.ids.Ens), nil
+}
+
+func (a *addressResolver) Identity(ctx context.Context) (*identityResolver, error) {
+	value, err := a.identity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &identityResolver{value}, nil
+}
+
+func (a *addressResolver) identity(ctx context.Context) (*identityValue, error) {
+	value, err := loadersFromContext(ctx).identities.load(ctx, a.address)
+	if err != nil {
+		return nil, err
+	}
+	return value.(*identityValue), nil
+}
+
+type pageArgs struct {
+	Platforms *[]string
+	First     *int32
+	After     *string
+}
+
+func (a *addressResolver) Followings(ctx context.Context, args pageArgs) (*addressPageResolver, error) {
+	return a.page(ctx, DirectionFollowing, args)
+}
+
+func (a *addressResolver) Followers(ctx context.Context, args pageArgs) (*addressPageResolver, error) {
+	return a.page(ctx, DirectionFollower, args)
+}
+
+// page lists the distinct addresses connected to a in direction, paged like the REST API
+func (a *addressResolver) page(ctx context.Context, direction string, args pageArgs) (*addressPageResolver, error) {
+	query := ConnectionsQuery{Direction: direction}
+	if args.Platforms != nil {
+		query.Platforms = *args.Platforms
+	}
+	first, maxFirst := int32(DefaultPageSize), int32(MaxPageSize)
+	if a.nested {
+		first, maxFirst = MaxNestedPageSize, MaxNestedPageSize
+	}
+	if args.First != nil {
+		first = *args.First
+	}
+	if first <= 0 || first > maxFirst {
+		return nil, &Error{Status: http.StatusBadRequest, Message: fmt.Sprintf("first must be between 1 and %d", maxFirst)}
+	}
+	query.Limit = int(first)
+	if args.After != nil {
+		query.Cursor = *args.After
+	}
+	if err := query.validate(); err != nil {
+		return nil, err
+	}
+
+	value, err := loadersFromContext(ctx).connections.load(ctx, a.address)
+	if err != nil {
+		return nil, err
+	}
+	result := value.(*fetcher.ConnectionResult)
+
+	var others []string
+	seen := make(map[string]bool)
+	for _, conn := range filterConnections(a.address, result.Conn, query) {
+		other := strings.ToLower(conn.From)
+		if direction == DirectionFollowing {
+			other = strings.ToLower(conn.To)
+		}
+		if !seen[other] {
+			seen[other] = true
+			others = append(others, other)
+		}
+	}
+
+	page := &addressPageResolver{totalCount: int32(len(others))}
+	offset, _ := query.offset()
+	if offset < len(others) {
+		end := offset + query.Limit
+		if end < len(others) {
+			page.nextCursor = optional(strconv.Itoa(end))
+		} else {
+			end = len(others)
+		}
+		for _, other := range others[offset:end] {
+			page.nodes = append(page.nodes, &addressResolver{s: a.s, address: other, nested: true})
+		}
+	}
+	return page, nil
+}
+
+type addressPageResolver struct {
+	totalCount int32
+	nextCursor *string
+	nodes      []*addressResolver
+}
+
+func (p *addressPageResolver) TotalCount() int32 {
+	return p.totalCount
+}
+
+func (p *addressPageResolver) NextCursor() *string {
+	return p.nextCursor
+}
+
+func (p *addressPageResolver) Nodes() []*addressResolver {
+	return p.nodes
+}
+
+type identityResolver struct {
+	value *identityValue
+}
+
+func (i *identityResolver) DisplayName() *string {
+	return optional(i.value.profile.DisplayName.Value)
+}
+
+func (i *identityResolver) Bio() *string {
+	return optional(i.value.profile.Bio.Value)
+}
+
+func (i *identityResolver) Avatar() *string {
+	return optional(i.value.profile.Avatar.Value)
+}
+
+func (i *identityResolver) Twitter() *string {
+	for _, social := range i.value.profile.Socials {
+		if social.Platform == fetcher.TWITTER {
+			return optional(social.Handle)
+		}
+	}
+	return nil
+}
+
+func (i *identityResolver) Websites() []string {
+	results := []string{}
+	for _, website := range i.value.profile.Websites {
+		results = append(results, website.Value)
+	}
+	return results
+}
+
+func (i *identityResolver) Socials() []*socialHandleResolver {
+	results := []*socialHandleResolver{}
+	for _, social := range i.value.profile.Socials {
+		results = append(results, &socialHandleResolver{social})
+	}
+	return results
+}
+
+func (i *identityResolver) Sources() []*sourceStatusResolver {
+	results := []*sourceStatusResolver{}
+	for _, status := range i.value.ids.Sources {
+		results = append(results, &sourceStatusResolver{status})
+	}
+	return results
+}
+
+type socialHandleResolver struct {
+	social fetcher.SocialHandle
+}
+
+func (s *socialHandleResolver) Platform() string {
+	return s.social.Platform
+}
+
+func (s *socialHandleResolver) Handle() string {
+	return s.social.Handle
+}
+
+func (s *socialHandleResolver) URL() *string {
+	return optional(s.social.URL)
+}
+
+func (s *socialHandleResolver) Sources() []string {
+	if s.social.Sources == nil {
+		return []string{}
+	}
+	return s.social.Sources
+}
+
+type sourceStatusResolver struct {
+	status fetcher.SourceStatus
+}
+
+func (s *sourceStatusResolver) Source() string {
+	return s.status.Source
+}
+
+func (s *sourceStatusResolver) Success() bool {
+	return s.status.Success
+}
+
+func (s *sourceStatusResolver) Error() *string {
+	if s.status.Err == nil {
+		return nil
+	}
+	return optional(s.status.Err.Error())
+}
+
+func (s *sourceStatusResolver) StatusCode() int32 {
+	return int32(s.status.StatusCode)
+}
+
+func (s *sourceStatusResolver) LatencyMs() int32 {
+	return int32(s.status.Latency / time.Millisecond)
+}
+
+func (s *sourceStatusResolver) Cache() *string {
+	return optional(s.status.Cache)
+}
+
+// optional maps the empty string to null
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func newSchema(s *Server) *graphql.Schema {
+	return graphql.MustParseSchema(Schema, &queryResolver{s: s}, graphql.MaxDepth(MaxGraphQLDepth))
+}
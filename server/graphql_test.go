@@ -0,0 +1,202 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cyberconnecthq/indexer/fetcher"
+)
+
+type graphqlResponse struct {
+	Data   json.RawMessage
+	Errors []struct {
+		Message string
+		Path    []interface{}
+	}
+}
+
+func doGraphQL(t *testing.T, s *Server, query string, variables map[string]interface{}, data interface{}) graphqlResponse {
+	t.Helper()
+	body, _ := json.Marshal(graphqlRequest{Query: query, Variables: variables})
+	var resp graphqlResponse
+	if code := do(t, s, "POST", "/v1/graphql", string(body), &resp); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if data != nil {
+		if err := json.Unmarshal(resp.Data, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp
+}
+
+func graphqlFetcher() *fakeFetcher {
+	return &fakeFetcher{conns: []fetcher.ConnectionEntry{
+		{From: alice, To: bob, Platform: fetcher.RARIBLE},
+		{From: bob, To: alice, Platform: fetcher.RARIBLE},
+		{From: bob, To: alice, Platform: fetcher.CONTEXT},
+		{From: carol, To: alice, Platform: fetcher.CONTEXT},
+	}}
+}
+
+func TestGraphQLFollowersWithTwitter(t *testing.T) {
+	f := graphqlFetcher()
+	s := New(f)
+	query := `query($id: String!) {
+		address(id: $id) {
+			id
+			ens
+			followers { totalCount nextCursor nodes { id identity { twitter displayName } } }
+			followings { nodes { id identity { twitter } } }
+		}
+	}`
+	var data struct {
+		Address struct {
+			ID         string
+			Ens        string
+			Followers  page
+			Followings page
+		}
+	}
+	resp := doGraphQL(t, s, query, map[string]interface{}{"id": "alice.eth"}, &data)
+	if len(resp.Errors) != 0 {
+		t.Fatalf("errors %+v", resp.Errors)
+	}
+
+	a := data.Address
+	if a.ID != alice || a.Ens != "alice.eth" {
+		t.Errorf("address %+v", a)
+	}
+	if a.Followers.TotalCount != 2 || a.Followers.NextCursor != nil || len(a.Followers.Nodes) != 2 {
+		t.Fatalf("followers %+v", a.Followers)
+	}
+	if n := a.Followers.Nodes[0]; n.ID != bob || n.Identity.Twitter != "twitter_b0" || n.Identity.DisplayName != "user-b0" {
+		t.Errorf("follower %+v", n)
+	}
+	if n := a.Followers.Nodes[1]; n.ID != carol || n.Identity.Twitter != "twitter_c0" {
+		t.Errorf("follower %+v", n)
+	}
+	if len(a.Followings.Nodes) != 1 || a.Followings.Nodes[0].Identity.Twitter != "twitter_b0" {
+		t.Errorf("followings %+v", a.Followings)
+	}
+
+	// bob is both a follower and a following, and alice's connections serve both lists
+	want := map[string]int{
+		"identity " + alice:    1,
+		"identity " + bob:      1,
+		"identity " + carol:    1,
+		"connections " + alice: 1,
+	}
+	for call, n := range want {
+		if f.calls[call] != n {
+			t.Errorf("%s fetched %d times, want %d", call, f.calls[call], n)
+		}
+	}
+	if len(f.calls) != len(want) {
+		t.Errorf("unexpected fetches %v", f.calls)
+	}
+}
+
+type page struct {
+	TotalCount int
+	NextCursor *string
+	Nodes      []struct {
+		ID       string
+		Identity struct {
+			Twitter     string
+			DisplayName string
+		}
+	}
+}
+
+func TestGraphQLLazy(t *testing.T) {
+	f := graphqlFetcher()
+	s := New(f)
+	resp := doGraphQL(t, s, `{ address(id: "alice.eth") { id } }`, nil, nil)
+	if len(resp.Errors) != 0 {
+		t.Fatalf("errors %+v", resp.Errors)
+	}
+	if len(f.calls) != 0 {
+		t.Errorf("unexpected fetches %v", f.calls)
+	}
+}
+
+func TestGraphQLPagination(t *testing.T) {
+	s := New(graphqlFetcher())
+	query := `query($after: String) {
+		address(id: "alice.eth") {
+			followers(first: 1, after: $after, platforms: ["context"]) { totalCount nextCursor nodes { id } }
+		}
+	}`
+	var data struct {
+		Address struct{ Followers page }
+	}
+	doGraphQL(t, s, query, nil, &data)
+	first := data.Address.Followers
+	if first.TotalCount != 2 || first.NextCursor == nil || len(first.Nodes) != 1 || first.Nodes[0].ID != bob {
+		t.Fatalf("first page %+v", first)
+	}
+
+	doGraphQL(t, s, query, map[string]interface{}{"after": *first.NextCursor}, &data)
+	second := data.Address.Followers
+	if second.NextCursor != nil || len(second.Nodes) != 1 || second.Nodes[0].ID != carol {
+		t.Errorf("second page %+v", second)
+	}
+}
+
+func TestGraphQLErrors(t *testing.T) {
+	s := New(&fakeFetcher{allFailed: true})
+	var data struct {
+		Addresses []*struct {
+			ID       string
+			Identity *struct{ Twitter string }
+		}
+	}
+	resp := doGraphQL(t, s, `{ addresses(ids: ["alice.eth", "nobody.eth"]) { id identity { twitter } } }`, nil, &data)
+	if len(data.Addresses) != 2 || data.Addresses[0] == nil || data.Addresses[1] != nil {
+		t.Fatalf("addresses %+v", data.Addresses)
+	}
+	if data.Addresses[0].Identity != nil {
+		t.Errorf("identity of failed sources %+v", data.Addresses[0].Identity)
+	}
+	if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, "failed") {
+		t.Errorf("errors %+v", resp.Errors)
+	}
+
+	resp = doGraphQL(t, New(graphqlFetcher()), `{ address(id: "alice.eth") { followers(first: 0) { totalCount } } }`, nil, nil)
+	if len(resp.Errors) != 1 {
+		t.Errorf("errors %+v", resp.Errors)
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	s := New(graphqlFetcher(), WithMaxBatchSize(2))
+
+	resp := doGraphQL(t, s, `{ addresses(ids: ["alice.eth", "bob.eth", "carol.eth"]) { id } }`, nil, nil)
+	if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, "at most 2") {
+		t.Errorf("too many ids: errors %+v", resp.Errors)
+	}
+
+	deep := `{ address(id: "alice.eth") { followers { nodes { followers { nodes { followers { nodes { identity { socials { sources } } } } } } } } } }`
+	resp = doGraphQL(t, s, deep, nil, nil)
+	if len(resp.Errors) == 0 || !strings.Contains(resp.Errors[0].Message, "depth") {
+		t.Errorf("too deep: errors %+v", resp.Errors)
+	}
+
+	nested := `query($first: Int) { address(id: "alice.eth") { followers { nodes { followings(first: $first) { totalCount } } } } }`
+	resp = doGraphQL(t, s, nested, map[string]interface{}{"first": MaxNestedPageSize + 1}, nil)
+	if len(resp.Errors) == 0 || !strings.Contains(resp.Errors[0].Message, "between 1 and 20") {
+		t.Errorf("nested page too large: errors %+v", resp.Errors)
+	}
+	// Nested pages default to their own limit
+	resp = doGraphQL(t, s, nested, nil, nil)
+	if len(resp.Errors) != 0 {
+		t.Errorf("nested page: errors %+v", resp.Errors)
+	}
+	resp = doGraphQL(t, s, `{ address(id: "alice.eth") { followers(first: 1000) { totalCount } } }`, nil, nil)
+	if len(resp.Errors) != 0 {
+		t.Errorf("top level page: errors %+v", resp.Errors)
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cyberconnecthq/indexer/fetcher"
+)
+
+// loader fetches each key at most once per GraphQL query, with at most cap(sem) fetches running
+// at the same time. The fetcher has no multi address call, so this is how the nested fields of a
+// list share upstream calls instead of making one per parent.
+type loader struct {
+	// ctx is the query context, fetches outlive the resolver that started them
+	ctx   context.Context
+	fetch func(ctx context.Context, key string) (interface{}, error)
+	sem   chan struct{}
+
+	mu    sync.Mutex
+	calls map[string]*loaderCall
+}
+
+type loaderCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+func newLoader(ctx context.Context, concurrency int, fetch func(ctx context.Context, key string) (interface{}, error)) *loader {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &loader{
+		ctx:   ctx,
+		fetch: fetch,
+		sem:   make(chan struct{}, concurrency),
+		calls: make(map[string]*loaderCall),
+	}
+}
+
+func (l *loader) load(ctx context.Context, key string) (interface{}, error) {
+	l.mu.Lock()
+	call, ok := l.calls[key]
+	if !ok {
+		call = &loaderCall{done: make(chan struct{})}
+		l.calls[key] = call
+		go l.run(key, call)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *loader) run(key string, call *loaderCall) {
+	defer close(call.done)
+	select {
+	case l.sem <- struct{}{}:
+	case <-l.ctx.Done():
+		call.err = l.ctx.Err()
+		return
+	}
+	defer func() { <-l.sem }()
+	call.value, call.err = l.fetch(l.ctx, key)
+}
+
+// loaders are the loaders of one GraphQL query
+type loaders struct {
+	identities  *loader
+	connections *loader
+}
+
+type loadersKey struct{}
+
+func (s *Server) withLoaders(ctx context.Context) context.Context {
+	l := &loaders{
+		identities:  newLoader(ctx, s.batchConcurrency, s.loadIdentity),
+		connections: newLoader(ctx, s.batchConcurrency, s.loadConnections),
+	}
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+func loadersFromContext(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// identityValue is what the identity loader stores for an address
+type identityValue struct {
+	ids     fetcher.IdentityEntryList
+	profile fetcher.MergedProfile
+}
+
+// loadIdentity fetches the identity of address, a partial result is not an error
+func (s *Server) loadIdentity(ctx context.Context, address string) (interface{}, error) {
+	ids, err := s.fetcher.FetchIdentityWithContext(ctx, address)
+	if _, e := checkFetchError(ctx, err, ids.Sources); e != nil {
+		return nil, e
+	}
+	return &identityValue{ids: ids, profile: fetcher.NewMergedProfile(ids, s.mergeOptions)}, nil
+}
+
+// loadConnections fetches the connections of address, a partial result is not an error
+func (s *Server) loadConnections(ctx context.Context, address string) (interface{}, error) {
+	result, err := s.fetcher.FetchConnectionsWithContext(ctx, address)
+	if _, e := checkFetchError(ctx, err, result.Sources); e != nil {
+		return nil, e
+	}
+	return &result, nil
+}
@@ -0,0 +1,253 @@
+// Package server exposes a fetcher over a JSON HTTP API.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cyberconnecthq/indexer/fetcher"
+	graphql "github.com/graph-gophers/graphql-go"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultTimeout      = 30 * time.Second
+	DefaultMaxBatchSize = 100
+	// DefaultBatchConcurrency is the number of batch items fetched at the same time
+	DefaultBatchConcurrency = 4
+)
+
+// Server routes,
+//
+//	GET  /v1/identity/{address}
+//	GET  /v1/connections/{address}?platform=&direction=&limit=&cursor=
+//	POST /v1/batch
+//	POST /v1/graphql
+//	GET  /healthz
+//	GET  /readyz
+//
+// {address} is either an address or an ENS name.
+type Server struct {
+	fetcher          fetcher.Fetcher
+	timeout          time.Duration
+	maxBatchSize     int
+	batchConcurrency int
+	mergeOptions     fetcher.MergeOptions
+	notReady         int32
+	schema           *graphql.Schema
+}
+
+type Option func(*Server)
+
+// WithTimeout bounds the time spent on a request, a batch shares one timeout for all its items
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.timeout = timeout
+	}
+}
+
+// WithMaxBatchSize caps the number of items of a batch request
+func WithMaxBatchSize(size int) Option {
+	return func(s *Server) {
+		s.maxBatchSize = size
+	}
+}
+
+// WithBatchConcurrency sets the number of batch items, or addresses of a GraphQL query, fetched at the same time
+func WithBatchConcurrency(n int) Option {
+	return func(s *Server) {
+		s.batchConcurrency = n
+	}
+}
+
+// WithMergeOptions sets how the profiles of identity responses and GraphQL queries are merged,
+// e.g. their source priority
+func WithMergeOptions(options fetcher.MergeOptions) Option {
+	return func(s *Server) {
+		s.mergeOptions = options
+	}
+}
+
+func New(f fetcher.Fetcher, options ...Option) *Server {
+	s := &Server{
+		fetcher:          f,
+		timeout:          DefaultTimeout,
+		maxBatchSize:     DefaultMaxBatchSize,
+		batchConcurrency: DefaultBatchConcurrency,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	s.schema = newSchema(s)
+	return s
+}
+
+// SetReady flips the readiness endpoint, e.g. to false while draining before a shutdown
+func (s *Server) SetReady(ready bool) {
+	var notReady int32
+	if !ready {
+		notReady = 1
+	}
+	atomic.StoreInt32(&s.notReady, notReady)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case path == "/healthz":
+		s.handleHealth(w, r)
+	case path == "/readyz":
+		s.handleReady(w, r)
+	case path == "/v1/batch":
+		s.handleBatch(w, r)
+	case path == "/v1/graphql":
+		s.handleGraphQL(w, r)
+	case strings.HasPrefix(path, "/v1/identity/"):
+		s.handleIdentity(w, r, strings.TrimPrefix(path, "/v1/identity/"))
+	case strings.HasPrefix(path, "/v1/connections/"):
+		s.handleConnections(w, r, strings.TrimPrefix(path, "/v1/connections/"))
+	default:
+		writeError(w, &Error{Status: http.StatusNotFound, Message: "no route for " + path})
+	}
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"Status": "ok"})
+}
+
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	if atomic.LoadInt32(&s.notReady) != 0 {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"Status": "not ready"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"Status": "ready"})
+}
+
+// IdentityResponse is the body of GET /v1/identity/{address}
+type IdentityResponse struct {
+	Address  string
+	Identity fetcher.IdentityEntryList
+	Profile  fetcher.MergedProfile
+	// Failed lists the sources that failed, the response is partial when it is not empty
+	Failed []fetcher.SourceStatus `json:",omitempty"`
+}
+
+func (s *Server) handleIdentity(w http.ResponseWriter, r *http.Request, input string) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+
+	resp, err := s.identity(ctx, input)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) identity(ctx context.Context, input string) (*IdentityResponse, *Error) {
+	address, err := s.resolve(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	ids, fetchErr := s.fetcher.FetchIdentityWithContext(ctx, address)
+	failed, err := checkFetchError(ctx, fetchErr, ids.Sources)
+	if err != nil {
+		return nil, err
+	}
+	return &IdentityResponse{
+		Address:  address,
+		Identity: ids,
+		Profile:  fetcher.NewMergedProfile(ids, s.mergeOptions),
+		Failed:   failed,
+	}, nil
+}
+
+func (s *Server) resolve(ctx context.Context, input string) (string, *Error) {
+	if input == "" || strings.Contains(input, "/") {
+		return "", &Error{Status: http.StatusNotFound, Message: "expected a single address or ENS name"}
+	}
+	address, err := s.fetcher.ResolveAddress(ctx, input)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", contextError(ctx)
+		}
+		return "", &Error{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+	return address, nil
+}
+
+// checkFetchError returns the failed sources of a partial result, and an error when there is no
+// result to serve at all: the request timed out or every source failed
+func checkFetchError(ctx context.Context, err error, sources []fetcher.SourceStatus) ([]fetcher.SourceStatus, *Error) {
+	if err == nil {
+		return nil, nil
+	}
+	if ctx.Err() != nil {
+		e := contextError(ctx)
+		e.Sources = sources
+		return nil, e
+	}
+	var partial *fetcher.PartialResultError
+	if !errors.As(err, &partial) {
+		return nil, &Error{Status: http.StatusInternalServerError, Message: err.Error()}
+	}
+	if len(partial.Failed) == len(sources) {
+		return nil, &Error{Status: http.StatusBadGateway, Message: err.Error(), Sources: sources}
+	}
+	return partial.Failed, nil
+}
+
+// Error is the body of every failed response, Sources reports how each data source behaved
+// when the failure comes from them
+type Error struct {
+	Status  int
+	Message string
+	Sources []fetcher.SourceStatus `json:",omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func contextError(ctx context.Context) *Error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return &Error{Status: http.StatusGatewayTimeout, Message: "request timed out"}
+	}
+	// The client went away, nobody reads the status
+	return &Error{Status: 499, Message: "request canceled"}
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, &Error{Status: http.StatusMethodNotAllowed, Message: r.Method + " is not allowed, use " + method})
+	return false
+}
+
+func writeError(w http.ResponseWriter, err *Error) {
+	writeJSON(w, err.Status, struct{ Error *Error }{err})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		zap.L().With(zap.Error(err)).Error("write response failed")
+	}
+}
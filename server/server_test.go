@@ -0,0 +1,434 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cyberconnecthq/indexer/fetcher"
+)
+
+const (
+	alice = "0x00000000000000000000000000000000000000a1"
+	bob   = "0x00000000000000000000000000000000000000b0"
+	carol = "0x00000000000000000000000000000000000000c0"
+)
+
+// fakeFetcher serves canned results, Failed sources turn them into partial results
+type fakeFetcher struct {
+	conns  []fetcher.ConnectionEntry
+	failed []string
+	// allFailed makes every source fail
+	allFailed bool
+	delay     time.Duration
+
+	mu sync.Mutex
+	// calls counts the fetches of every method and address, e.g. "identity 0x..."
+	calls map[string]int
+}
+
+func (f *fakeFetcher) sources() ([]fetcher.SourceStatus, error) {
+	statuses := []fetcher.SourceStatus{{Source: fetcher.RARIBLE, Success: true}}
+	if f.allFailed {
+		statuses[0] = fetcher.SourceStatus{Source: fetcher.RARIBLE, Err: errors.New("boom")}
+	}
+	for _, name := range f.failed {
+		statuses = append(statuses, fetcher.SourceStatus{Source: name, Err: errors.New("boom")})
+	}
+	var failed []fetcher.SourceStatus
+	for _, status := range statuses {
+		if !status.Success {
+			failed = append(failed, status)
+		}
+	}
+	if len(failed) == 0 {
+		return statuses, nil
+	}
+	return statuses, &fetcher.PartialResultError{Failed: failed}
+}
+
+func (f *fakeFetcher) wait(ctx context.Context, call string) error {
+	f.mu.Lock()
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[call]++
+	f.mu.Unlock()
+	select {
+	case <-time.After(f.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *fakeFetcher) FetchConnections(address string) (fetcher.ConnectionResult, error) {
+	return f.FetchConnectionsWithContext(context.Background(), address)
+}
+
+func (f *fakeFetcher) FetchConnectionsWithContext(ctx context.Context, address string) (fetcher.ConnectionResult, error) {
+	if err := f.wait(ctx, "connections "+address); err != nil {
+		return fetcher.ConnectionResult{}, err
+	}
+	result := fetcher.ConnectionResult{Conn: f.conns}
+	var err error
+	result.Sources, err = f.sources()
+	return result, err
+}
+
+func (f *fakeFetcher) FetchIdentity(address string) (fetcher.IdentityEntryList, error) {
+	return f.FetchIdentityWithContext(context.Background(), address)
+}
+
+func (f *fakeFetcher) FetchIdentityWithContext(ctx context.Context, address string) (fetcher.IdentityEntryList, error) {
+	if err := f.wait(ctx, "identity "+address); err != nil {
+		return fetcher.IdentityEntryList{}, err
+	}
+	suffix := address[len(address)-2:]
+	ids := fetcher.IdentityEntryList{
+		Rarible: []fetcher.UserRaribleIdentity{{Username: "user-" + suffix, DataSource: fetcher.RARIBLE}},
+		Twitter: []fetcher.UserTwitterIdentity{{Handle: "twitter_" + suffix, Verified: true, DataSource: fetcher.SYBIL}},
+		Context: []fetcher.UserContextIdentity{{Username: "context-" + suffix, DataSource: fetcher.CONTEXT}},
+	}
+	if address == alice {
+		ids.Ens = "alice.eth"
+	}
+	var err error
+	ids.Sources, err = f.sources()
+	return ids, err
+}
+
+func (f *fakeFetcher) ResolveAddress(ctx context.Context, input string) (string, error) {
+	switch strings.ToLower(input) {
+	case alice, "alice.eth":
+		return alice, nil
+	case bob, carol:
+		return input, nil
+	}
+	return "", fmt.Errorf("%q does not resolve to an address", input)
+}
+
+func do(t *testing.T, s *Server, method, target, body string, v interface{}) int {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s %s: content type %q", method, target, ct)
+	}
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, target, err, rec.Body.String())
+		}
+	}
+	return rec.Code
+}
+
+type errorResponse struct {
+	Error struct {
+		Status  int
+		Message string
+		Sources []struct {
+			Source string
+			Err    string
+		}
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	s := New(&fakeFetcher{})
+	var resp IdentityResponse
+	if code := do(t, s, "GET", "/v1/identity/alice.eth", "", &resp); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if resp.Address != alice || len(resp.Identity.Rarible) != 1 || resp.Profile.DisplayName.Value != "user-a1" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if len(resp.Failed) != 0 {
+		t.Errorf("unexpected failed sources %+v", resp.Failed)
+	}
+}
+
+func TestIdentityMergeOptions(t *testing.T) {
+	s := New(&fakeFetcher{}, WithMergeOptions(fetcher.MergeOptions{SourcePriority: []string{fetcher.CONTEXT}}))
+	var resp IdentityResponse
+	if code := do(t, s, "GET", "/v1/identity/alice.eth", "", &resp); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if resp.Profile.DisplayName.Value != "context-a1" {
+		t.Errorf("display name %+v", resp.Profile.DisplayName)
+	}
+
+	var data struct {
+		Address struct{ Identity struct{ DisplayName string } }
+	}
+	doGraphQL(t, s, `{ address(id: "alice.eth") { identity { displayName } } }`, nil, &data)
+	if data.Address.Identity.DisplayName != "context-a1" {
+		t.Errorf("graphql display name %q", data.Address.Identity.DisplayName)
+	}
+}
+
+func TestIdentityPartial(t *testing.T) {
+	s := New(&fakeFetcher{failed: []string{fetcher.CONTEXT}})
+	var resp struct {
+		Failed []struct {
+			Source string
+			Err    string
+		}
+	}
+	if code := do(t, s, "GET", "/v1/identity/"+alice, "", &resp); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if len(resp.Failed) != 1 || resp.Failed[0].Source != fetcher.CONTEXT || resp.Failed[0].Err != "boom" {
+		t.Errorf("unexpected failed sources %+v", resp.Failed)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		fetcher *fakeFetcher
+		method  string
+		target  string
+		status  int
+		sources int
+	}{
+		{"unknown route", &fakeFetcher{}, "GET", "/v2/identity/" + alice, http.StatusNotFound, 0},
+		{"method", &fakeFetcher{}, "POST", "/v1/identity/" + alice, http.StatusMethodNotAllowed, 0},
+		{"unresolvable", &fakeFetcher{}, "GET", "/v1/identity/nobody.eth", http.StatusBadRequest, 0},
+		{"nested path", &fakeFetcher{}, "GET", "/v1/identity/" + alice + "/x", http.StatusNotFound, 0},
+		{"all sources failed", &fakeFetcher{allFailed: true}, "GET", "/v1/identity/" + alice, http.StatusBadGateway, 1},
+		{"bad direction", &fakeFetcher{}, "GET", "/v1/connections/" + alice + "?direction=up", http.StatusBadRequest, 0},
+		{"bad limit", &fakeFetcher{}, "GET", "/v1/connections/" + alice + "?limit=5000", http.StatusBadRequest, 0},
+		{"zero limit", &fakeFetcher{}, "GET", "/v1/connections/" + alice + "?limit=0", http.StatusBadRequest, 0},
+		{"bad cursor", &fakeFetcher{}, "GET", "/v1/connections/" + alice + "?cursor=x", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp errorResponse
+			code := do(t, New(tt.fetcher), tt.method, tt.target, "", &resp)
+			if code != tt.status || resp.Error.Status != tt.status || resp.Error.Message == "" {
+				t.Errorf("got %d %+v, want %d", code, resp, tt.status)
+			}
+			if len(resp.Error.Sources) != tt.sources {
+				t.Errorf("got %d sources, want %d", len(resp.Error.Sources), tt.sources)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	s := New(&fakeFetcher{delay: time.Second}, WithTimeout(10*time.Millisecond))
+	var resp errorResponse
+	if code := do(t, s, "GET", "/v1/identity/"+alice, "", &resp); code != http.StatusGatewayTimeout {
+		t.Errorf("status %d, want %d", code, http.StatusGatewayTimeout)
+	}
+}
+
+// The 504 of connections reports the sources that answered in time, like identity does
+func TestTimeoutPartialSources(t *testing.T) {
+	f := fetcher.NewFetcher(
+		fetcher.WithConnectionSources(
+			fetcher.NewConnectionSource("Slow", func(ctx context.Context, address string) fetcher.ConnectionEntryList {
+				<-ctx.Done()
+				return fetcher.ConnectionEntryList{Err: ctx.Err()}
+			}),
+			fetcher.NewConnectionSource("Fast", func(ctx context.Context, address string) fetcher.ConnectionEntryList {
+				return fetcher.ConnectionEntryList{Conn: []fetcher.ConnectionEntry{{From: alice, To: bob, Platform: "Fast"}}}
+			}),
+		),
+		fetcher.WithSources("Slow", "Fast"),
+	)
+	s := New(f, WithTimeout(50*time.Millisecond))
+	var resp errorResponse
+	if code := do(t, s, "GET", "/v1/connections/"+alice, "", &resp); code != http.StatusGatewayTimeout {
+		t.Fatalf("status %d, want %d", code, http.StatusGatewayTimeout)
+	}
+	if len(resp.Error.Sources) != 1 || resp.Error.Sources[0].Source != "Fast" {
+		t.Errorf("sources %+v", resp.Error.Sources)
+	}
+}
+
+func TestConnections(t *testing.T) {
+	f := &fakeFetcher{conns: []fetcher.ConnectionEntry{
+		{From: alice, To: bob, Platform: fetcher.RARIBLE},
+		{From: bob, To: alice, Platform: fetcher.RARIBLE},
+		{From: alice, To: carol, Platform: fetcher.CONTEXT},
+		{From: carol, To: alice, Platform: fetcher.RARIBLE},
+	}}
+	s := New(f)
+
+	tests := []struct {
+		query string
+		want  []string
+		total int
+		next  string
+	}{
+		{"", []string{bob, bob, carol, carol}, 4, ""},
+		{"?direction=following", []string{bob, carol}, 2, ""},
+		{"?direction=follower", []string{bob, carol}, 2, ""},
+		{"?direction=mutual", []string{bob, bob, carol, carol}, 4, ""},
+		{"?direction=mutual&platform=rarible", []string{bob, bob}, 2, ""},
+		{"?platform=Context,Convo", []string{carol}, 1, ""},
+		{"?limit=3", []string{bob, bob, carol}, 4, "3"},
+		{"?limit=3&cursor=3", []string{carol}, 4, ""},
+		{"?cursor=10", nil, 4, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var resp ConnectionsResponse
+			if code := do(t, s, "GET", "/v1/connections/"+alice+tt.query, "", &resp); code != http.StatusOK {
+				t.Fatalf("status %d", code)
+			}
+			var got []string
+			for _, conn := range resp.Conn {
+				other := conn.From
+				if other == alice {
+					other = conn.To
+				}
+				got = append(got, other)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) || resp.Total != tt.total || resp.NextCursor != tt.next {
+				t.Errorf("got %v total %d next %q, want %v total %d next %q",
+					got, resp.Total, resp.NextCursor, tt.want, tt.total, tt.next)
+			}
+		})
+	}
+}
+
+func TestBatch(t *testing.T) {
+	f := &fakeFetcher{conns: []fetcher.ConnectionEntry{{From: alice, To: bob, Platform: fetcher.RARIBLE}}}
+	s := New(f)
+	body := `{"requests": [
+		{"type": "identity", "address": "alice.eth"},
+		{"type": "connections", "address": "` + alice + `", "direction": "follower"},
+		{"type": "identity", "address": "nobody.eth"},
+		{"type": "profile", "address": "` + alice + `"}
+	]}`
+	var resp BatchResponse
+	if code := do(t, s, "POST", "/v1/batch", body, &resp); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if len(resp.Results) != 4 {
+		t.Fatalf("got %d results", len(resp.Results))
+	}
+	if r := resp.Results[0]; r.Identity == nil || r.Identity.Address != alice || r.Error != nil {
+		t.Errorf("identity result %+v", r)
+	}
+	if r := resp.Results[1]; r.Connections == nil || r.Connections.Total != 0 || r.Error != nil {
+		t.Errorf("connections result %+v", r)
+	}
+	for _, r := range resp.Results[2:] {
+		if r.Error == nil || r.Error.Status != http.StatusBadRequest {
+			t.Errorf("expected a bad request error, got %+v", r)
+		}
+	}
+}
+
+func TestBatchLimits(t *testing.T) {
+	s := New(&fakeFetcher{}, WithMaxBatchSize(1))
+	var resp errorResponse
+	if code := do(t, s, "POST", "/v1/batch", `{"requests": []}`, &resp); code != http.StatusBadRequest {
+		t.Errorf("empty batch: status %d", code)
+	}
+	two := `{"requests": [{"type": "identity", "address": "alice.eth"}, {"type": "identity", "address": "alice.eth"}]}`
+	if code := do(t, s, "POST", "/v1/batch", two, &resp); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized batch: status %d", code)
+	}
+	if code := do(t, s, "POST", "/v1/batch", `{`, &resp); code != http.StatusBadRequest {
+		t.Errorf("malformed batch: status %d", code)
+	}
+	if code := do(t, s, "GET", "/v1/batch", "", &resp); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET batch: status %d", code)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	s := New(&fakeFetcher{})
+	if code := do(t, s, "GET", "/healthz", "", nil); code != http.StatusOK {
+		t.Errorf("healthz: status %d", code)
+	}
+	if code := do(t, s, "GET", "/readyz", "", nil); code != http.StatusOK {
+		t.Errorf("readyz: status %d", code)
+	}
+	s.SetReady(false)
+	if code := do(t, s, "GET", "/readyz", "", nil); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz while draining: status %d", code)
+	}
+	if code := do(t, s, "GET", "/healthz", "", nil); code != http.StatusOK {
+		t.Errorf("healthz while draining: status %d", code)
+	}
+}
+
+// Pages are cut from the merged connections, which must not depend on the order sources answer in
+func TestConnectionsPagingStable(t *testing.T) {
+	var calls int32
+	// Every call the other source answers first
+	source := func(name string, slowOnOdd bool, conns ...fetcher.ConnectionEntry) fetcher.ConnectionSource {
+		return fetcher.NewConnectionSource(name, func(ctx context.Context, address string) fetcher.ConnectionEntryList {
+			if odd := (atomic.AddInt32(&calls, 1)-1)/2%2 == 1; odd == slowOnOdd {
+				time.Sleep(20 * time.Millisecond)
+			}
+			return fetcher.ConnectionEntryList{Conn: conns}
+		})
+	}
+	f := fetcher.NewFetcher(
+		fetcher.WithConnectionSources(
+			source("First", true, fetcher.ConnectionEntry{From: alice, To: bob, Platform: "First"}, fetcher.ConnectionEntry{From: carol, To: alice, Platform: "First"}),
+			source("Second", false, fetcher.ConnectionEntry{From: alice, To: carol, Platform: "Second"}, fetcher.ConnectionEntry{From: bob, To: alice, Platform: "Second"}),
+		),
+		fetcher.WithSources("First", "Second"),
+	)
+	s := New(f)
+
+	var got []string
+	cursor := ""
+	for i := 0; i < 4; i++ {
+		var resp ConnectionsResponse
+		if code := do(t, s, "GET", "/v1/connections/"+alice+"?limit=1&cursor="+cursor, "", &resp); code != http.StatusOK {
+			t.Fatalf("status %d", code)
+		}
+		for _, conn := range resp.Conn {
+			got = append(got, conn.Platform+" "+conn.From+" "+conn.To)
+		}
+		cursor = resp.NextCursor
+	}
+	want := []string{
+		"First " + alice + " " + bob,
+		"First " + carol + " " + alice,
+		"Second " + alice + " " + carol,
+		"Second " + bob + " " + alice,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) || cursor != "" {
+		t.Errorf("pages %v, want %v", got, want)
+	}
+
+	query := `query($after: String) {
+		address(id: "` + alice + `") { followers(first: 1, after: $after) { nextCursor nodes { id } } }
+	}`
+	var followers []string
+	var after interface{}
+	for i := 0; i < 2; i++ {
+		var data struct {
+			Address struct{ Followers page }
+		}
+		doGraphQL(t, s, query, map[string]interface{}{"after": after}, &data)
+		for _, node := range data.Address.Followers.Nodes {
+			followers = append(followers, node.ID)
+		}
+		if next := data.Address.Followers.NextCursor; next != nil {
+			after = *next
+		}
+	}
+	if fmt.Sprint(followers) != fmt.Sprint([]string{carol, bob}) {
+		t.Errorf("followers %v", followers)
+	}
+}